@@ -0,0 +1,82 @@
+package clipboard
+
+import (
+	"context"
+	"fmt"
+)
+
+// backendByName constructs the named backend for a single operation, bypassing the active one
+func backendByName(name string) (clipboarder, error) {
+	if state == nil {
+		return nil, fmt.Errorf("clipboard not initialized")
+	}
+	switch name {
+	case BackendSystem:
+		state.mu.RLock()
+		available := state.systemReady
+		state.mu.RUnlock()
+		if !available {
+			return nil, fmt.Errorf("system clipboard backend is not available")
+		}
+		return primaryClipboard(), nil
+	case BackendCLI:
+		if !CLIClipboardAvailable {
+			return nil, clipboardUnavailableErr
+		}
+		return getCLIClipboard(), nil
+	case BackendMemory:
+		return state.fallback, nil
+	default:
+		return nil, fmt.Errorf("unknown clipboard backend %q (expected %s, %s or %s)", name, BackendSystem, BackendCLI, BackendMemory)
+	}
+}
+
+// CopyWithBackend writes data using the named backend instead of the active one, e.g. to compare backends
+func CopyWithBackend(name string, data []byte) error {
+	backend, err := backendByName(name)
+	if err != nil {
+		return err
+	}
+	// The backend may well hold the clipboard, whose new content a pending expiry must not clear
+	cancelExpiry()
+	_, err = withTimeout(func() ([]byte, error) {
+		return nil, backend.Copy(trimNullTerminator(data))
+	})
+	return bumpVersionOnSuccess("", err)
+}
+
+// PasteWithBackend reads data using the named backend instead of the active one
+func PasteWithBackend(name string) ([]byte, error) {
+	backend, err := backendByName(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := withTimeout(backend.Paste)
+	if err != nil {
+		return nil, err
+	}
+	return trimNullTerminator(data), nil
+}
+
+// withTimeout runs op, giving up after clipboardTimeout without switching backends
+func withTimeout(op func() ([]byte, error)) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), clipboardTimeout)
+	defer cancel()
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := op()
+		done <- result{data, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("clipboard backend did not respond within %s", clipboardTimeout)
+	}
+}
@@ -2,56 +2,167 @@ package clipboard
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"regexp"
+	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	loggingEnabled = false
-	state          *clipboardState
+	loggingEnabled   = false
+	replayOnRecovery = false
+	state            *clipboardState
 )
 
+// Defaults for SetTimeouts
 const (
-	clipboardTimeout    = 2 * time.Second
-	healthCheckInterval = 5 * time.Second
+	DefaultTimeout             = 2 * time.Second
+	DefaultHealthCheckInterval = 5 * time.Second
+)
+
+var (
+	clipboardTimeout    = DefaultTimeout             // how long an operation may take before the fallback takes over
+	healthCheckInterval = DefaultHealthCheckInterval // how often the health check polls a failed system clipboard
+)
+
+// The platform's system clipboard and its recovery check, kept in variables so tests can swap in fakes
+var (
+	primaryClipboard    = getPrimaryClipboard
+	clipboardResponsive = isClipboardResponsive
+)
+
+// healthChecks counts health check goroutines started and not yet stopping; ensureHealthCheck keeps it at one at most
+var healthChecks atomic.Int32
+
+// Backend names reported by ActiveBackend
+const (
+	BackendSystem = "system"
+	BackendCLI    = "cli"
+	BackendMemory = "memory"
 )
 
 // clipboarder defines the interface for clipboard operations.
 type clipboarder interface {
 	Copy(data []byte) error
 	Paste() ([]byte, error)
+	CopyImage(data []byte) error
+	PasteImage() ([]byte, error)
+	Name() string
 }
 
 // inMemoryClipboard is used as a fallback when the system clipboard is not available.
+// Content above spillThreshold is kept in a temp file rather than in data.
 type inMemoryClipboard struct {
-	mu   sync.RWMutex
-	data []byte
+	mu        sync.RWMutex
+	data      []byte
+	spillPath string
+	format    string // FormatText or FormatImage; empty until first written, which reads as text
 }
 
 func (c *inMemoryClipboard) Copy(data []byte) error {
+	return c.store(FormatText, data)
+}
+
+func (c *inMemoryClipboard) CopyImage(data []byte) error {
+	return c.store(FormatImage, data)
+}
+
+// store replaces the content and records its format
+func (c *inMemoryClipboard) store(format string, data []byte) error {
+	var path string
+	if spillThreshold > 0 && int64(len(data)) > spillThreshold {
+		var err error
+		if path, err = spill(data); err != nil {
+			return err
+		}
+		logf("Spilled %d bytes of clipboard content to %s", len(data), path)
+		data = nil
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if c.spillPath != "" {
+		os.Remove(c.spillPath)
+	}
 	c.data = data
+	c.spillPath = path
+	c.format = format
 	return nil
 }
 
+// Paste reads text; like a system clipboard holding only an image, image content reads as empty text
 func (c *inMemoryClipboard) Paste() ([]byte, error) {
+	format, data, err := c.content()
+	if err != nil || format == FormatImage {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (c *inMemoryClipboard) PasteImage() ([]byte, error) {
+	format, data, err := c.content()
+	if err != nil {
+		return nil, err
+	}
+	if format != FormatImage {
+		return nil, errNoImage
+	}
+	return data, nil
+}
+
+// content returns the content along with its format, whichever that is
+func (c *inMemoryClipboard) content() (string, []byte, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.data, nil
+	format := c.format
+	if format == "" {
+		format = FormatText
+	}
+	if c.spillPath != "" {
+		data, err := os.ReadFile(c.spillPath)
+		return format, data, err
+	}
+	return format, c.data, nil
+}
+
+// Size returns the length of the content without reading it
+func (c *inMemoryClipboard) Size() (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.spillPath != "" {
+		info, err := os.Stat(c.spillPath)
+		if err != nil {
+			return 0, err
+		}
+		return int(info.Size()), nil
+	}
+	return len(c.data), nil
+}
+
+func (c *inMemoryClipboard) Name() string {
+	return BackendMemory
 }
 
 // clipboardState tracks which clipboard implementation is active
 type clipboardState struct {
-	mu              sync.RWMutex
-	active          clipboarder
-	fallback        *inMemoryClipboard
-	usingFallback   bool
-	healthCheckDone chan struct{} // signals health check to stop
+	mu             sync.RWMutex
+	active         clipboarder
+	fallback       *inMemoryClipboard
+	usingFallback  bool
+	fallbackDirty  bool // fallback holds content written while the system clipboard was down
+	healthChecking bool // a health check goroutine is polling for recovery
+	fallbackPinned bool // fallback chosen manually, so never switch back automatically
+	systemReady    bool // the platform system clipboard initialized successfully
+	watchers       *watcherRegistry
+	registers      *registerStore           // named clipboards such as per-key ones
+	histories      map[string]*historyStore // recent copies by register name, "" for the active clipboard
+	expiry         *time.Timer              // clears the clipboard when a copy made with a TTL expires, nil if none is pending
+	expiresAt      time.Time                // when expiry fires, zero if none is pending
+	version        versionCounter           // bumped by every write through this package
 }
 
 // EnableLogging turns on logging for clipboard operations
@@ -59,6 +170,24 @@ func EnableLogging() {
 	loggingEnabled = true
 }
 
+// EnableReplayOnRecovery makes the system clipboard receive the last content copied
+// into the in-memory fallback once it recovers, so that content isn't lost from it
+func EnableReplayOnRecovery() {
+	replayOnRecovery = true
+}
+
+// SetTimeouts sets how long a clipboard operation may take before the fallback takes over, and how
+// often the health check polls a failed system clipboard for recovery. Call it before Init; zero keeps
+// the current value.
+func SetTimeouts(timeout, healthInterval time.Duration) {
+	if timeout > 0 {
+		clipboardTimeout = timeout
+	}
+	if healthInterval > 0 {
+		healthCheckInterval = healthInterval
+	}
+}
+
 // logf conditionally logs based on loggingEnabled flag
 func logf(format string, args ...interface{}) {
 	if loggingEnabled {
@@ -74,8 +203,9 @@ func Init() error {
 
 	fallback := &inMemoryClipboard{}
 	state = &clipboardState{
-		fallback:        fallback,
-		healthCheckDone: make(chan struct{}),
+		fallback:  fallback,
+		watchers:  newWatcherRegistry(),
+		registers: newRegisterStore(),
 	}
 
 	return initPlatformClipboard(fallback)
@@ -89,6 +219,7 @@ func UseInMemoryClipboard() {
 	defer state.mu.Unlock()
 	state.active = state.fallback
 	state.usingFallback = true
+	state.fallbackPinned = true
 	logf("Switched to in-memory clipboard (manual flag)")
 }
 
@@ -102,6 +233,7 @@ func UseCliClipboard() error {
 	defer state.mu.Unlock()
 	state.active = getCLIClipboard()
 	state.usingFallback = false
+	state.fallbackPinned = false
 	logf("Switched to CLI clipboard tools (manual flag)")
 	return nil
 }
@@ -126,6 +258,20 @@ func isUsingFallback() bool {
 	return state.usingFallback
 }
 
+// ActiveBackend returns the name of the clipboard implementation currently serving operations
+func ActiveBackend() string {
+	active := getActiveClipboard()
+	if active == nil {
+		return ""
+	}
+	return active.Name()
+}
+
+// IsUsingFallback reports whether the in-memory fallback is serving clipboard operations
+func IsUsingFallback() bool {
+	return isUsingFallback()
+}
+
 // switchToFallback switches to the fallback clipboard and starts health check
 func switchToFallback() {
 	if state == nil {
@@ -138,31 +284,67 @@ func switchToFallback() {
 	state.mu.Unlock()
 
 	if !wasUsingFallback {
-		logf("System clipboard unresponsive, switched to in-memory fallback (health check polling every 5s)")
-		go startHealthCheck()
+		logf("System clipboard unresponsive or failing, switched to in-memory fallback (health check polling every %v)", healthCheckInterval)
 	}
+	ensureHealthCheck()
 }
 
-// switchToSystem switches back to the system clipboard and stops health check
+// switchToSystem switches back to the system clipboard; the health check stops once it sees this
 func switchToSystem() {
 	if state == nil {
 		return
 	}
+	primary := primaryClipboard()
+	state.mu.Lock()
+	replay := replayOnRecovery && state.fallbackDirty
+	state.fallbackDirty = false
+	state.mu.Unlock()
+
+	// Replay before switching so no newer copy to the system clipboard can be overwritten
+	if replay {
+		if format, data, err := state.fallback.content(); err == nil {
+			if err := writeAs(primary, format, data); err != nil {
+				logf("Failed to replay fallback content into recovered system clipboard: %v", err)
+			} else {
+				logf("Replayed %d bytes from fallback into recovered system clipboard", len(data))
+			}
+		}
+	}
+
 	state.mu.Lock()
-	state.active = getPrimaryClipboard()
+	state.active = primary
 	state.usingFallback = false
 	state.mu.Unlock()
 
 	logf("System clipboard recovered, switched back from fallback")
-	// Signal health check to stop
-	select {
-	case state.healthCheckDone <- struct{}{}:
-	default:
-	}
 }
 
 // Copy writes the given data with timeout and auto-switching
 func Copy(data []byte) error {
+	return CopyAs(FormatText, data)
+}
+
+// Clear empties the active clipboard and the in-memory fallback, so content such as a password
+// doesn't linger in either, and removes that content from the history. It goes through the same
+// timeout and fallback handling as Copy.
+func Clear() error {
+	if state == nil {
+		return fmt.Errorf("clipboard not initialized")
+	}
+	forgetCleared("", paste)
+	cancelExpiry()
+	if err := copyActive(FormatText, nil); err != nil {
+		return err
+	}
+	state.mu.Lock()
+	state.fallbackDirty = false
+	state.mu.Unlock()
+	return bumpVersionOnSuccess("", state.fallback.Copy(nil))
+}
+
+// copyActive writes data in format to the active clipboard, switching to the fallback if it fails or
+// times out. A backend unable to handle the format at all reports that instead of falling back.
+func copyActive(format string, data []byte) error {
 	active := getActiveClipboard()
 	if active == nil {
 		return fmt.Errorf("clipboard not initialized")
@@ -170,7 +352,8 @@ func Copy(data []byte) error {
 
 	// For fallback, no timeout needed (it's local and fast)
 	if isUsingFallback() {
-		return active.Copy(data)
+		markFallbackWritten()
+		return writeAs(active, format, data)
 	}
 
 	// For system clipboard, use timeout
@@ -179,21 +362,50 @@ func Copy(data []byte) error {
 
 	done := make(chan error, 1)
 	go func() {
-		done <- active.Copy(data)
+		done <- withRetry(ctx, active.Name(), func() error {
+			return writeAs(active, format, data)
+		})
 	}()
 
 	select {
 	case err := <-done:
-		return err
+		if errors.Is(err, ErrTargetUnavailable) {
+			return err
+		}
+		if err != nil {
+			// A failing clipboard is as unusable as a hung one, so fall back just the same
+			logf("%s clipboard write failed: %v", active.Name(), err)
+			switchToFallback()
+			markFallbackWritten()
+			return writeAs(state.fallback, format, data)
+		}
+		if managerCompatDelay > 0 && format == FormatText {
+			return verifyCopy(active, data)
+		}
+		return nil
 	case <-ctx.Done():
 		switchToFallback()
+		markFallbackWritten()
 		// Retry with fallback
-		return state.fallback.Copy(data)
+		return writeAs(state.fallback, format, data)
 	}
 }
 
+// markFallbackWritten records that the fallback holds content the system clipboard never received
+func markFallbackWritten() {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.fallbackDirty = true
+}
+
 // Paste reads data with timeout and auto-switching
 func Paste() ([]byte, error) {
+	return PasteAs(FormatText)
+}
+
+// paste reads format from the active clipboard, switching to the fallback if it fails or doesn't
+// answer in time. Content missing in that format is reported rather than treated as a failure.
+func paste(format string) ([]byte, error) {
 	active := getActiveClipboard()
 	if active == nil {
 		return nil, fmt.Errorf("clipboard not initialized")
@@ -201,7 +413,7 @@ func Paste() ([]byte, error) {
 
 	// For fallback, no timeout needed (it's local and fast)
 	if isUsingFallback() {
-		return active.Paste()
+		return readAs(active, format)
 	}
 
 	// For system clipboard, use timeout
@@ -211,7 +423,11 @@ func Paste() ([]byte, error) {
 	done := make(chan []byte, 1)
 	doneErr := make(chan error, 1)
 	go func() {
-		data, err := active.Paste()
+		var data []byte
+		err := withRetry(ctx, active.Name(), func() (err error) {
+			data, err = readAs(active, format)
+			return err
+		})
 		if err != nil {
 			doneErr <- err
 		} else {
@@ -223,46 +439,95 @@ func Paste() ([]byte, error) {
 	case data := <-done:
 		return data, nil
 	case err := <-doneErr:
-		return nil, err
+		if errors.Is(err, ErrTargetUnavailable) {
+			return nil, err
+		}
+		logf("%s clipboard read failed: %v", active.Name(), err)
+		switchToFallback()
+		return readAs(state.fallback, format)
 	case <-ctx.Done():
 		switchToFallback()
 		// Retry with fallback
-		return state.fallback.Paste()
+		return readAs(state.fallback, format)
+	}
+}
+
+// Size returns the length of the clipboard content. The in-memory fallback answers without
+// copying its content; system clipboards have to be read.
+func Size() (int, error) {
+	if active := getActiveClipboard(); active != nil && isUsingFallback() {
+		return state.fallback.Size()
+	}
+	data, err := Paste()
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// ensureHealthCheck starts polling for recovery unless a health check is already running,
+// so exactly one runs for as long as the fallback is in use
+func ensureHealthCheck() {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.healthChecking || !state.usingFallback || state.fallbackPinned {
+		return
 	}
+	state.healthChecking = true
+	healthChecks.Add(1)
+	go startHealthCheck()
 }
 
-// startHealthCheck polls the clipboard every 5s to detect recovery
+// startHealthCheck polls the clipboard every healthCheckInterval to detect recovery. It stops by itself once
+// the fallback is no longer in use, so there is no stop signal to miss, and restarts itself
+// if it panics while the fallback is still active.
 func startHealthCheck() {
+	defer func() {
+		if r := recover(); r != nil {
+			state.mu.Lock()
+			state.healthChecking = false
+			healthChecks.Add(-1)
+			state.mu.Unlock()
+			logf("Clipboard health check panicked, restarting it: %v", r)
+			ensureHealthCheck()
+		}
+	}()
+
 	ticker := time.NewTicker(healthCheckInterval)
 	defer ticker.Stop()
 
 	for {
-		select {
-		case <-state.healthCheckDone:
+		// Deciding to stop and clearing healthChecking happen under one lock, so a switch
+		// to fallback in between can't be left without a health check
+		state.mu.Lock()
+		if !state.usingFallback || state.fallbackPinned {
+			state.healthChecking = false
+			healthChecks.Add(-1)
+			state.mu.Unlock()
 			return
-		case <-ticker.C:
-			if isClipboardResponsive() {
-				switchToSystem()
-				return
-			}
+		}
+		state.mu.Unlock()
+
+		<-ticker.C
+		if clipboardResponsive() {
+			switchToSystem()
 		}
 	}
 }
 
 // ConvertLE is used to normalize line endings when exchanging clipboard content.
 // This can be used on the client side if needed.
+// CRLF, LF and lone CR line breaks are all recognized, so converting is idempotent
+// and lf and crlf round-trip into each other.
 func ConvertLE(text, op string) string {
 	switch {
 	case strings.EqualFold("lf", op):
 		text = strings.ReplaceAll(text, "\r\n", "\n")
 		return strings.ReplaceAll(text, "\r", "\n")
 	case strings.EqualFold("crlf", op):
-		text = regexp.MustCompile(`\r(.)|\r$`).ReplaceAllString(text, "\r\n$1")
-		text = regexp.MustCompile(`([^\r])\n|^\n`).ReplaceAllString(text, "$1\r\n")
-		return text
+		// Normalizing to LF first keeps existing CRLFs from being doubled
+		return strings.ReplaceAll(ConvertLE(text, "lf"), "\n", "\r\n")
 	default:
 		return text
 	}
 }
-
-
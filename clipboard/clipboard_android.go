@@ -10,11 +10,23 @@ import (
 type cliClipboard struct{}
 
 func (c *cliClipboard) Copy(data []byte) error {
-	return WriteClipboardCLI(data)
+	return WriteClipboardCLI(data, "")
 }
 
 func (c *cliClipboard) Paste() ([]byte, error) {
-	return ReadClipboardCLI()
+	return ReadClipboardCLI("")
+}
+
+func (c *cliClipboard) CopyImage(data []byte) error {
+	return WriteClipboardCLI(data, ImageMIMEType)
+}
+
+func (c *cliClipboard) PasteImage() ([]byte, error) {
+	return ReadClipboardCLI(ImageMIMEType)
+}
+
+func (c *cliClipboard) Name() string {
+	return BackendCLI
 }
 
 // initPlatformClipboard tries CLI tools first, then falls back to in-memory.
@@ -49,8 +61,8 @@ func isClipboardResponsive() bool {
 	done := make(chan bool, 1)
 	go func() {
 		// Quick test read
-		_, _ = ReadClipboardCLI()
-		done <- true
+		_, err := ReadClipboardCLI("")
+		done <- err == nil
 	}()
 
 	select {
@@ -1,9 +1,14 @@
 package clipboard
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strings"
+	"syscall"
 )
 
 const (
@@ -35,6 +40,9 @@ var (
 	termuxCopyArgs  = []string{cliTermuxClipboardSet}
 
 	clipboardUnavailableErr = errors.New("no clipboard utilities available: install xsel, xclip, wl-clipboard, or enable Termux:API")
+
+	// ErrTargetUnavailable means the requested clipboard target can't be read or written with the available tool
+	ErrTargetUnavailable = errors.New("clipboard target not available")
 )
 
 // initCLIClipboard detects available clipboard CLI tools
@@ -80,27 +88,67 @@ func hasCommand(cmd string) bool {
 	return err == nil
 }
 
-// ReadClipboardCLI reads data from the system clipboard using external CLI tools
-func ReadClipboardCLI() ([]byte, error) {
+// targetArgs returns the arguments making tool operate on a clipboard target (MIME type) instead of plain text
+func targetArgs(tool, target string) ([]string, error) {
+	if target == "" {
+		return nil, nil
+	}
+	switch tool {
+	case cliXclip:
+		return []string{"-t", target}, nil
+	case cliWlcopy, cliWlpaste:
+		return []string{"--type", target}, nil
+	default:
+		return nil, fmt.Errorf("%s cannot select clipboard target %q: %w", tool, target, ErrTargetUnavailable)
+	}
+}
+
+// ReadClipboardCLI reads data from the system clipboard using external CLI tools.
+// A non-empty target reads that clipboard target, e.g. text/html or image/png; when the
+// clipboard doesn't hold it the error wraps ErrTargetUnavailable so callers can fall back to text.
+func ReadClipboardCLI(target string) ([]byte, error) {
 	if !CLIClipboardAvailable {
 		return nil, clipboardUnavailableErr
 	}
 
-	cmd := exec.Command(pasteCmdArgs[0], pasteCmdArgs[1:]...)
-	out, err := cmd.Output()
+	extra, err := targetArgs(pasteCmdArgs[0], target)
 	if err != nil {
 		return nil, err
 	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(pasteCmdArgs[0], append(pasteCmdArgs[1:len(pasteCmdArgs):len(pasteCmdArgs)], extra...)...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := stderr.String()
+		if target != "" && (strings.Contains(msg, "not available") || strings.Contains(msg, "No suitable type")) {
+			return nil, fmt.Errorf("clipboard has no %s content: %w", target, ErrTargetUnavailable)
+		}
+		// xclip and wl-paste fail on an empty clipboard; that is empty content, not a broken clipboard
+		if target == "" && (strings.Contains(msg, "not available") || strings.Contains(msg, "Nothing is copied") || strings.Contains(msg, "No selection")) {
+			return nil, nil
+		}
+		return nil, cliToolError(pasteCmdArgs[0], err, &stderr)
+	}
 	return out, nil
 }
 
-// WriteClipboardCLI writes data to the system clipboard using external CLI tools
-func WriteClipboardCLI(data []byte) error {
+// WriteClipboardCLI writes data to the system clipboard using external CLI tools.
+// A non-empty target offers the data as that clipboard target instead of plain text.
+func WriteClipboardCLI(data []byte, target string) error {
 	if !CLIClipboardAvailable {
 		return clipboardUnavailableErr
 	}
 
-	cmd := exec.Command(copyCmdArgs[0], copyCmdArgs[1:]...)
+	extra, err := targetArgs(copyCmdArgs[0], target)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(copyCmdArgs[0], append(copyCmdArgs[1:len(copyCmdArgs):len(copyCmdArgs)], extra...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
 	in, err := cmd.StdinPipe()
 	if err != nil {
 		return err
@@ -111,6 +159,13 @@ func WriteClipboardCLI(data []byte) error {
 	}
 
 	if _, err := in.Write(data); err != nil {
+		// The tool exited before reading everything (e.g. no clipboard manager running);
+		// its exit status and stderr explain why far better than the broken pipe does
+		if errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrClosedPipe) {
+			if waitErr := cmd.Wait(); waitErr != nil {
+				return cliToolError(copyCmdArgs[0], waitErr, &stderr)
+			}
+		}
 		return err
 	}
 
@@ -118,7 +173,18 @@ func WriteClipboardCLI(data []byte) error {
 		return err
 	}
 
-	return cmd.Wait()
+	if err := cmd.Wait(); err != nil {
+		return cliToolError(copyCmdArgs[0], err, &stderr)
+	}
+	return nil
+}
+
+// cliToolError describes a failed clipboard tool run, including what it printed to stderr
+func cliToolError(tool string, err error, stderr *bytes.Buffer) error {
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("%s failed: %w: %s", tool, err, msg)
+	}
+	return fmt.Errorf("%s failed: %w", tool, err)
 }
 
 func init() {
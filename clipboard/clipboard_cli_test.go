@@ -0,0 +1,33 @@
+package clipboard
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestWriteClipboardCLIToolExitsEarly runs a copy tool that exits without reading its input, as one does
+// when no clipboard is reachable, and checks the error explains why instead of reporting a broken pipe
+func TestWriteClipboardCLIToolExitsEarly(t *testing.T) {
+	savedArgs, savedAvailable := copyCmdArgs, CLIClipboardAvailable
+	copyCmdArgs = []string{"sh", "-c", "echo boom >&2; exit 1"}
+	CLIClipboardAvailable = true
+	t.Cleanup(func() { copyCmdArgs, CLIClipboardAvailable = savedArgs, savedAvailable })
+
+	for _, size := range []int{5, 4 << 20} {
+		// Large content fills the pipe after the tool exited, small content fits in it
+		err := WriteClipboardCLI(bytes.Repeat([]byte("x"), size), "")
+		if err == nil {
+			t.Fatalf("writing %d bytes to a failing tool succeeded", size)
+		}
+		if !strings.Contains(err.Error(), "boom") {
+			t.Errorf("writing %d bytes: error %q doesn't carry the tool's stderr", size, err)
+		}
+		if errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrClosedPipe) {
+			t.Errorf("writing %d bytes: error %q is the broken pipe, not the tool's failure", size, err)
+		}
+	}
+}
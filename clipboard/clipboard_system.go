@@ -4,31 +4,90 @@ package clipboard
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	xclip "golang.design/x/clipboard"
 )
 
+// errSystemWrite means golang.design could not write to the system clipboard
+var errSystemWrite = errors.New("could not take clipboard ownership")
+
 // systemClipboard interacts with the actual system's clipboard using golang.design.
 type systemClipboard struct{}
 
 func (c *systemClipboard) Copy(data []byte) error {
-	xclip.Write(xclip.FmtText, data)
-	return nil
+	return c.write(xclip.FmtText, data)
+}
+
+func (c *systemClipboard) CopyImage(data []byte) error {
+	return c.write(xclip.FmtImage, data)
+}
+
+func (c *systemClipboard) write(format xclip.Format, data []byte) error {
+	// golang.design doesn't return write errors. A failed write returns no channel, or one that has
+	// already fired because the goroutine meant to hold clipboard ownership exited straight away
+	changed := xclip.Write(format, data)
+	if changed == nil {
+		return errSystemWrite
+	}
+	select {
+	case <-changed:
+		return errSystemWrite
+	default:
+		return nil
+	}
 }
 
+// Paste reads the clipboard. golang.design returns nothing both for an empty clipboard and for a
+// failed read, so when nothing is read the clipboard is probed, and a failed probe is an error the
+// caller can fall back on; otherwise the clipboard is empty
 func (c *systemClipboard) Paste() ([]byte, error) {
 	data := xclip.Read(xclip.FmtText)
+	if data == nil {
+		if err := probeSystemClipboard(); err != nil {
+			return nil, fmt.Errorf("could not read system clipboard: %w", err)
+		}
+	}
 	return data, nil
 }
 
+// PasteImage reads a PNG image; nothing read from a clipboard that passes the probe means it holds no image
+func (c *systemClipboard) PasteImage() ([]byte, error) {
+	data := xclip.Read(xclip.FmtImage)
+	if data == nil {
+		if err := probeSystemClipboard(); err != nil {
+			return nil, fmt.Errorf("could not read system clipboard: %w", err)
+		}
+		return nil, errNoImage
+	}
+	return data, nil
+}
+
+func (c *systemClipboard) Name() string {
+	return BackendSystem
+}
+
 // cliClipboard interacts with the system's clipboard using CLI tools.
 type cliClipboard struct{}
 
 func (c *cliClipboard) Copy(data []byte) error {
-	return WriteClipboardCLI(data)
+	return WriteClipboardCLI(data, "")
 }
 
 func (c *cliClipboard) Paste() ([]byte, error) {
-	return ReadClipboardCLI()
+	return ReadClipboardCLI("")
+}
+
+func (c *cliClipboard) CopyImage(data []byte) error {
+	return WriteClipboardCLI(data, ImageMIMEType)
+}
+
+func (c *cliClipboard) PasteImage() ([]byte, error) {
+	return ReadClipboardCLI(ImageMIMEType)
+}
+
+func (c *cliClipboard) Name() string {
+	return BackendCLI
 }
 
 // initPlatformClipboard tries golang.design first, then CLI tools, then falls back to in-memory.
@@ -38,6 +97,7 @@ func initPlatformClipboard(fallback *inMemoryClipboard) error {
 	if err == nil {
 		state.active = &systemClipboard{}
 		state.usingFallback = false
+		state.systemReady = true
 		logf("Using system clipboard (golang.design)")
 		return nil
 	}
@@ -73,8 +133,11 @@ func isClipboardResponsive() bool {
 
 	done := make(chan bool, 1)
 	go func() {
-		// Quick test read
-		_ = xclip.Read(xclip.FmtText)
+		// Quick test read; reading nothing may mean the display is still gone
+		if xclip.Read(xclip.FmtText) == nil {
+			done <- probeSystemClipboard() == nil
+			return
+		}
 		done <- true
 	}()
 
@@ -0,0 +1,278 @@
+package clipboard
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errFakeClipboard = errors.New("fake clipboard failure")
+
+// fakeClipboard stands in for the system clipboard, failing its next failures operations
+type fakeClipboard struct {
+	mu       sync.Mutex
+	data     []byte
+	failures int
+	calls    int
+}
+
+func (c *fakeClipboard) Copy(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(); err != nil {
+		return err
+	}
+	c.data = bytes.Clone(data)
+	return nil
+}
+
+func (c *fakeClipboard) Paste() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(c.data), nil
+}
+
+func (c *fakeClipboard) CopyImage(data []byte) error {
+	return c.Copy(data)
+}
+
+func (c *fakeClipboard) PasteImage() ([]byte, error) {
+	return c.Paste()
+}
+
+func (c *fakeClipboard) Name() string {
+	return BackendSystem
+}
+
+// call counts an operation and fails it while failures remain; c.mu must be held
+func (c *fakeClipboard) call() error {
+	c.calls++
+	if c.failures > 0 {
+		c.failures--
+		return errFakeClipboard
+	}
+	return nil
+}
+
+// setFailures makes the next n operations fail and resets the call count
+func (c *fakeClipboard) setFailures(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = n
+	c.calls = 0
+}
+
+func (c *fakeClipboard) callCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+// useTestState gives the test a fresh clipboard whose system clipboard is system, or the in-memory
+// fallback alone when system is nil, with a fast health check. Everything is restored afterwards.
+func useTestState(t *testing.T, system clipboarder) {
+	t.Helper()
+	savedState, savedPrimary, savedResponsive := state, primaryClipboard, clipboardResponsive
+	savedInterval, savedTimeout := healthCheckInterval, clipboardTimeout
+
+	fallback := &inMemoryClipboard{}
+	state = &clipboardState{
+		active:    system,
+		fallback:  fallback,
+		watchers:  newWatcherRegistry(),
+		registers: newRegisterStore(),
+	}
+	if system == nil {
+		state.active = fallback
+		state.usingFallback = true
+		state.fallbackPinned = true
+	}
+	primaryClipboard = func() clipboarder { return system }
+	clipboardResponsive = func() bool { return true }
+	healthCheckInterval = time.Millisecond
+
+	t.Cleanup(func() {
+		// Pinning the fallback stops any health check still polling before the state goes away
+		state.mu.Lock()
+		state.fallbackPinned = true
+		state.mu.Unlock()
+		waitFor(t, "health check to stop", func() bool { return healthChecks.Load() == 0 })
+		// A stopping health check holds the lock until it no longer touches the state
+		state.mu.Lock()
+		state.mu.Unlock()
+		state.watchers.pollers.Wait()
+		cancelExpiry()
+
+		state, primaryClipboard, clipboardResponsive = savedState, savedPrimary, savedResponsive
+		healthCheckInterval, clipboardTimeout = savedInterval, savedTimeout
+	})
+}
+
+// waitFor polls cond until it holds, failing the test if it doesn't within a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// TestHealthCheckAfterRecovery switches back to the system clipboard, lets the health check exit and
+// fails again, several goroutines at once, checking that exactly one health check is then polling
+func TestHealthCheckAfterRecovery(t *testing.T) {
+	useTestState(t, &fakeClipboard{})
+	var responsive atomic.Bool
+	clipboardResponsive = responsive.Load
+
+	for i := 0; i < 50; i++ {
+		responsive.Store(false)
+		switchToFallback()
+		waitFor(t, "health check to start", func() bool { return healthChecks.Load() == 1 })
+
+		// Recovery found by the health check, which then exits
+		responsive.Store(true)
+		waitFor(t, "recovery", func() bool { return !IsUsingFallback() && healthChecks.Load() == 0 })
+
+		// Failing again right after the health check exited must start exactly one new one
+		responsive.Store(false)
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				switchToFallback()
+			}()
+		}
+		wg.Wait()
+		waitFor(t, "health check to restart", func() bool { return healthChecks.Load() == 1 })
+		time.Sleep(5 * time.Millisecond)
+		if n := healthChecks.Load(); n != 1 || !IsUsingFallback() {
+			t.Fatalf("iteration %d: %d health checks running (fallback in use: %v), want exactly 1", i, n, IsUsingFallback())
+		}
+
+		// Switching back by other means than the health check also lets it exit
+		switchToSystem()
+		waitFor(t, "health check to exit", func() bool { return healthChecks.Load() == 0 })
+	}
+}
+
+func TestConvertLE(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		lf   string
+		crlf string
+	}{
+		{"empty", "", "", ""},
+		{"no line breaks", "abc", "abc", "abc"},
+		{"blank lines", "\n\n", "\n\n", "\r\n\r\n"},
+		{"lone CR at EOF", "a\r", "a\n", "a\r\n"},
+		{"CRLF blank lines", "\r\n\r\n", "\n\n", "\r\n\r\n"},
+		{"leading LF", "\na", "\na", "\r\na"},
+		{"mixed endings", "a\r\nb\nc\rd", "a\nb\nc\nd", "a\r\nb\r\nc\r\nd"},
+		{"CR before CRLF", "a\r\r\nb", "a\n\nb", "a\r\n\r\nb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ConvertLE(tt.in, "lf"); got != tt.lf {
+				t.Errorf("ConvertLE(%q, lf) = %q, want %q", tt.in, got, tt.lf)
+			}
+			if got := ConvertLE(tt.in, "crlf"); got != tt.crlf {
+				t.Errorf("ConvertLE(%q, crlf) = %q, want %q", tt.in, got, tt.crlf)
+			}
+			if got := ConvertLE(tt.in, "CRLF"); got != tt.crlf {
+				t.Errorf("ConvertLE(%q, CRLF) = %q, want %q", tt.in, got, tt.crlf)
+			}
+			if got := ConvertLE(tt.in, ""); got != tt.in {
+				t.Errorf("ConvertLE(%q, \"\") = %q, want it unchanged", tt.in, got)
+			}
+		})
+	}
+}
+
+func FuzzConvertLE(f *testing.F) {
+	for _, seed := range []string{"", "a\nb", "a\r\nb", "a\rb", "\n\n", "\r", "\r\n\r\n", "\na", "a\r\r\nb\n\r"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		lf := ConvertLE(text, "lf")
+		crlf := ConvertLE(lf, "crlf")
+		if back := ConvertLE(crlf, "lf"); back != lf {
+			t.Errorf("lf->crlf->lf of %q gave %q, want %q", text, back, lf)
+		}
+		if again := ConvertLE(lf, "lf"); again != lf {
+			t.Errorf("lf of %q is not idempotent: %q then %q", text, lf, again)
+		}
+		if again := ConvertLE(crlf, "crlf"); again != crlf {
+			t.Errorf("crlf of %q is not idempotent: %q then %q", text, crlf, again)
+		}
+	})
+}
+
+func TestSpillStreamedAndRemoved(t *testing.T) {
+	useTestState(t, nil)
+	savedThreshold := spillThreshold
+	EnableSpill(4)
+	t.Cleanup(func() { spillThreshold = savedThreshold })
+
+	if rc, _, err := OpenSpilled("", FormatText); rc != nil || err != nil {
+		t.Fatalf("empty clipboard opened as spilled: %v", err)
+	}
+	if err := Copy([]byte("spilled content")); err != nil {
+		t.Fatal(err)
+	}
+	if rc, _, err := OpenSpilled("", FormatImage); rc != nil || err != nil {
+		t.Errorf("text content opened as a spilled image: %v", err)
+	}
+
+	rc, size, err := OpenSpilled("", FormatText)
+	if err != nil || rc == nil {
+		t.Fatalf("spilled content not opened: %v", err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(got) != "spilled content" || size != int64(len(got)) {
+		t.Errorf("spilled content streams as %q (size %d), %v", got, size, err)
+	}
+
+	path := state.fallback.spillPath
+	if err := RemoveSpillFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("spill file still exists after RemoveSpillFiles: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+		t.Errorf("spill directory still exists after RemoveSpillFiles: %v", err)
+	}
+}
+
+func TestVersionPerRegister(t *testing.T) {
+	useTestState(t, nil)
+
+	if err := Copy([]byte("clipboard")); err != nil {
+		t.Fatal(err)
+	}
+	if err := CopyRegisterAs("alice", FormatText, []byte("register")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ClearRegister("alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	for register, want := range map[string]uint64{"": 1, "alice": 2, "bob": 0} {
+		if got := Version(register); got != want {
+			t.Errorf("version of register %q is %d, want %d", register, got, want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package clipboard
+
+import (
+	"time"
+)
+
+// CopyExpiring writes data like CopyAs and clears the clipboard once ttl has passed, unless something
+// else is copied first. Content meant to expire is kept out of the history. Callers holding LockWrites
+// around their own writes can't have them cleared by an expiry that was due at the same time.
+func CopyExpiring(format string, data []byte, ttl time.Duration) error {
+	if err := copyAs(format, data, false); err != nil {
+		return err
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	var timer *time.Timer
+	timer = time.AfterFunc(ttl, func() {
+		// Checking and clearing under the write lock keeps a copy from landing in between and being wiped
+		LockWrites()
+		defer UnlockWrites()
+		// timer is assigned under state.mu, so it must be read under it too
+		state.mu.Lock()
+		current := state.expiry == timer
+		state.mu.Unlock()
+		// Every write to the clipboard cancels the pending expiry, so a newer copy replaced this one meanwhile.
+		// Version can't tell, since register writes bump it too and must not keep expired content around.
+		if current {
+			expire()
+		}
+	})
+	state.expiry = timer
+	state.expiresAt = time.Now().Add(ttl)
+	return nil
+}
+
+// cancelExpiry stops the pending expiry, if any, because the content it would clear is being replaced
+func cancelExpiry() {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.expiry != nil {
+		state.expiry.Stop()
+		state.expiry = nil
+		state.expiresAt = time.Time{}
+	}
+}
+
+// ExpiresIn returns how long until the clipboard is cleared because a copy made with CopyExpiring
+// expires, or zero if no expiry is pending
+func ExpiresIn() time.Duration {
+	if state == nil {
+		return 0
+	}
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	if state.expiry == nil {
+		return 0
+	}
+	return max(time.Until(state.expiresAt), 0)
+}
+
+// expire clears the clipboard whose TTL ran out
+func expire() {
+	if err := Clear(); err != nil {
+		logf("Failed to clear expired clipboard content: %v", err)
+		return
+	}
+	logf("Cleared clipboard content whose TTL expired")
+}
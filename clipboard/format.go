@@ -0,0 +1,132 @@
+package clipboard
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Content formats a clipboard can hold
+const (
+	FormatText  = "text"
+	FormatImage = "image"
+)
+
+// ImageMIMEType is the clipboard target and content type used for images
+const ImageMIMEType = "image/png"
+
+// pngMagic starts every PNG file
+var pngMagic = []byte("\x89PNG\r\n\x1a\n")
+
+// errNoImage means an image was requested but the clipboard holds something else
+var errNoImage = fmt.Errorf("clipboard has no image content: %w", ErrTargetUnavailable)
+
+// IsPNG reports whether data starts with the PNG signature
+func IsPNG(data []byte) bool {
+	return bytes.HasPrefix(data, pngMagic)
+}
+
+// CopyAs writes data in the given format with timeout and auto-switching. Text is written
+// exactly like Copy; images are stored as PNG.
+func CopyAs(format string, data []byte) error {
+	return copyAs(format, data, true)
+}
+
+// copyAs writes data to the active clipboard, cancelling any pending expiry, and records it
+// in the history if asked to
+func copyAs(format string, data []byte, record bool) error {
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	if state == nil {
+		return fmt.Errorf("clipboard not initialized")
+	}
+	if format == FormatText {
+		data = trimNullTerminator(data)
+	}
+	cancelExpiry()
+	err := copyActive(format, data)
+	if err == nil && record {
+		recordHistory("", format, data)
+	}
+	return bumpVersionOnSuccess("", err)
+}
+
+// PasteAs reads the clipboard content in the given format. Asking for an image when the
+// clipboard holds none returns an error wrapping ErrTargetUnavailable.
+func PasteAs(format string) ([]byte, error) {
+	if err := checkFormat(format); err != nil {
+		return nil, err
+	}
+	data, err := paste(format)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatText {
+		data = trimNullTerminator(data)
+	}
+	return data, nil
+}
+
+// CopyRegisterAs writes data in the given format into the named register
+func CopyRegisterAs(name, format string, data []byte) error {
+	return copyRegisterAs(name, format, data, true)
+}
+
+// copyRegisterAs is CopyRegisterAs, remembering the copy in the register's history only if record is set
+func copyRegisterAs(name, format string, data []byte, record bool) error {
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	if state == nil {
+		return fmt.Errorf("clipboard not initialized")
+	}
+	if format == FormatText {
+		data = trimNullTerminator(data)
+	}
+	err := writeAs(state.registers.get(name), format, data)
+	if err == nil && record {
+		recordHistory(name, format, data)
+	}
+	return bumpVersionOnSuccess(name, err)
+}
+
+// PasteRegisterAs reads the named register in the given format; a register never written to is empty
+func PasteRegisterAs(name, format string) ([]byte, error) {
+	if err := checkFormat(format); err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, fmt.Errorf("clipboard not initialized")
+	}
+	reg := state.registers.lookup(name)
+	if reg == nil {
+		return nil, nil
+	}
+	return readAs(reg, format)
+}
+
+// checkFormat rejects anything but FormatText and FormatImage
+func checkFormat(format string) error {
+	switch format {
+	case FormatText, FormatImage:
+		return nil
+	default:
+		return fmt.Errorf("unknown clipboard format %q (expected %s or %s)", format, FormatText, FormatImage)
+	}
+}
+
+// writeAs writes data to c in format
+func writeAs(c clipboarder, format string, data []byte) error {
+	if format == FormatImage {
+		return c.CopyImage(data)
+	}
+	return c.Copy(data)
+}
+
+// readAs reads format from c
+func readAs(c clipboarder, format string) ([]byte, error) {
+	if format == FormatImage {
+		return c.PasteImage()
+	}
+	return c.Paste()
+}
@@ -0,0 +1,260 @@
+package clipboard
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrNoHistoryEntry means RestoreHistory was given an index outside the history
+var ErrNoHistoryEntry = errors.New("no such history entry")
+
+// historyHeadSize is how much of each entry's content HistoryEntry.Head holds, enough for a one-line preview
+const historyHeadSize = 256
+
+var (
+	historyLimit    int   // how many copies each register's history remembers; zero disables history
+	historyMaxBytes int64 // how many bytes of content each register's history holds at most; zero is unlimited
+)
+
+// EnableHistory makes the clipboard remember the last limit copies to the active clipboard, holding at
+// most maxBytes of their content (zero for no byte limit), so History can list them and RestoreHistory
+// can bring one back. The oldest entries are dropped to stay within both limits, and a copy larger than
+// maxBytes isn't remembered at all. Every register keeps a history of its own within the same limits,
+// so a busy register can't push the other registers' copies out.
+func EnableHistory(limit int, maxBytes int64) {
+	historyLimit = limit
+	historyMaxBytes = maxBytes
+}
+
+// HistoryEntry describes one remembered copy
+type HistoryEntry struct {
+	Format string // FormatText or FormatImage
+	Time   time.Time
+	Size   int
+	Head   []byte // the start of the content, at most historyHeadSize bytes cut on a character boundary
+}
+
+// historyItem is a remembered copy along with its content, which is kept in a temp file
+// rather than in data when it is larger than spillThreshold
+type historyItem struct {
+	HistoryEntry
+	data      []byte
+	spillPath string
+}
+
+// content returns the item's content, reading it back from its spill file if need be
+func (item *historyItem) content() ([]byte, error) {
+	if item.spillPath != "" {
+		return os.ReadFile(item.spillPath)
+	}
+	return item.data, nil
+}
+
+// discard removes the item's spill file, if any
+func (item *historyItem) discard() {
+	if item.spillPath != "" {
+		os.Remove(item.spillPath)
+	}
+}
+
+// historyStore holds one register's remembered copies, oldest first, within historyLimit and historyMaxBytes
+type historyStore struct {
+	items []*historyItem
+	bytes int64 // total size of the items' content
+}
+
+// record remembers a copy made at the given time unless it repeats the newest entry, dropping the oldest
+// entries as needed. It reports whether the history changed.
+func (h *historyStore) record(format string, data []byte, at time.Time) (bool, error) {
+	size := int64(len(data))
+	if historyMaxBytes > 0 && size > historyMaxBytes {
+		logf("Not remembering a %d byte copy in the history, it is over the %d byte history limit", size, historyMaxBytes)
+		return false, nil
+	}
+	if n := len(h.items); n > 0 {
+		if newest := h.items[n-1]; newest.Format == format && newest.Size == len(data) {
+			if content, err := newest.content(); err == nil && bytes.Equal(content, data) {
+				return false, nil
+			}
+		}
+	}
+
+	item := &historyItem{HistoryEntry: HistoryEntry{Format: format, Time: at, Size: len(data), Head: historyHead(data)}}
+	if spillThreshold > 0 && size > spillThreshold {
+		path, err := spill(data)
+		if err != nil {
+			return false, err
+		}
+		item.spillPath = path
+	} else {
+		item.data = bytes.Clone(data)
+	}
+
+	for len(h.items) > 0 && (len(h.items) >= historyLimit || (historyMaxBytes > 0 && h.bytes+size > historyMaxBytes)) {
+		h.drop()
+	}
+	h.items = append(h.items, item)
+	h.bytes += size
+	return true, nil
+}
+
+// drop forgets the oldest entry
+func (h *historyStore) drop() {
+	h.remove(0)
+}
+
+// remove forgets the entry at index i, counted from the oldest
+func (h *historyStore) remove(i int) {
+	item := h.items[i]
+	item.discard()
+	h.bytes -= int64(item.Size)
+	// Shift rather than reslice, so the backing array doesn't keep growing
+	copy(h.items[i:], h.items[i+1:])
+	h.items[len(h.items)-1] = nil
+	h.items = h.items[:len(h.items)-1]
+}
+
+// forget removes every entry holding data in format, reporting whether there was any
+func (h *historyStore) forget(format string, data []byte) bool {
+	forgotten := false
+	for i := len(h.items) - 1; i >= 0; i-- {
+		item := h.items[i]
+		if item.Format != format || item.Size != len(data) {
+			continue
+		}
+		if content, err := item.content(); err == nil && bytes.Equal(content, data) {
+			h.remove(i)
+			forgotten = true
+		}
+	}
+	return forgotten
+}
+
+// historyHead returns up to historyHeadSize bytes from the start of data, backing off to the start of
+// a character so that a cut doesn't make text look like binary
+func historyHead(data []byte) []byte {
+	if len(data) <= historyHeadSize {
+		return bytes.Clone(data)
+	}
+	n := historyHeadSize
+	for i := 0; i < utf8.UTFMax && n > 0 && !utf8.RuneStart(data[n]); i++ {
+		n--
+	}
+	return bytes.Clone(data[:n])
+}
+
+// historyOf returns the named register's history, creating it empty if create is set; state.mu must be
+// held, for writing if create is set
+func historyOf(register string, create bool) *historyStore {
+	h := state.histories[register]
+	if h == nil && create {
+		if state.histories == nil {
+			state.histories = make(map[string]*historyStore)
+		}
+		h = &historyStore{}
+		state.histories[register] = h
+	}
+	return h
+}
+
+// recordHistory remembers a copy to the named register, "" being the active clipboard
+func recordHistory(register, format string, data []byte) {
+	if historyLimit <= 0 || state == nil {
+		return
+	}
+	state.mu.Lock()
+	changed, err := historyOf(register, true).record(format, data, time.Now())
+	state.mu.Unlock()
+	if err != nil {
+		logf("Failed to remember copy in the history: %v", err)
+	}
+	if changed {
+		saveHistory()
+	}
+}
+
+// forgetCleared removes the named register's content, "" being the active clipboard, from its history
+// before the register is cleared, so cleared content such as a password can't be listed or restored
+// afterwards and leaves the history file too. read returns the register's content in a format. When it
+// can't be read, the newest entry is forgotten, as it most likely is what is being cleared.
+func forgetCleared(register string, read func(format string) ([]byte, error)) {
+	if historyLimit <= 0 || state == nil {
+		return
+	}
+	state.mu.RLock()
+	var format string
+	if h := historyOf(register, false); h != nil && len(h.items) > 0 {
+		format = h.items[len(h.items)-1].Format
+	}
+	state.mu.RUnlock()
+	if format == "" {
+		return
+	}
+
+	// Reading may go to the system clipboard, so it happens without holding the lock
+	data, err := read(format)
+
+	state.mu.Lock()
+	changed := false
+	if h := historyOf(register, false); h != nil && len(h.items) > 0 {
+		if err != nil {
+			h.remove(len(h.items) - 1)
+			changed = true
+		} else {
+			changed = h.forget(format, data)
+		}
+	}
+	state.mu.Unlock()
+	if changed {
+		saveHistory()
+	}
+}
+
+// History returns the copies remembered for the named register, "" being the active clipboard, newest first
+func History(register string) []HistoryEntry {
+	if state == nil {
+		return nil
+	}
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	h := historyOf(register, false)
+	if h == nil {
+		return nil
+	}
+	entries := make([]HistoryEntry, len(h.items))
+	for i, item := range h.items {
+		entries[len(entries)-1-i] = item.HistoryEntry
+	}
+	return entries
+}
+
+// RestoreHistory copies the entry at index, as numbered by History, back into the named register, "" being
+// the active clipboard, where it becomes the newest entry
+func RestoreHistory(register string, index int) error {
+	if state == nil {
+		return fmt.Errorf("clipboard not initialized")
+	}
+	state.mu.RLock()
+	var items []*historyItem
+	if h := historyOf(register, false); h != nil {
+		items = h.items
+	}
+	if index < 0 || index >= len(items) {
+		state.mu.RUnlock()
+		return fmt.Errorf("%w: %d (history has %d entries)", ErrNoHistoryEntry, index, len(items))
+	}
+	item := items[len(items)-1-index]
+	data, err := item.content()
+	state.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("could not read history entry %d: %w", index, err)
+	}
+	if register != "" {
+		return CopyRegisterAs(register, item.Format, data)
+	}
+	return CopyAs(item.Format, data)
+}
@@ -0,0 +1,126 @@
+package clipboard
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"pb/util"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	historyFile         string     // where the history is saved whenever it changes; empty keeps it in memory only
+	historyFileMaxEntry int64      // entries larger than this aren't saved; zero is unlimited
+	historyFileMu       sync.Mutex // serializes saves, so an older snapshot can't overwrite a newer one
+)
+
+// historyFileEntry is how a remembered copy is saved, readable as JSON with the content base64-encoded.
+// Register is empty for the active clipboard's history.
+type historyFileEntry struct {
+	Register      string    `json:"register,omitempty"`
+	Format        string    `json:"format"`
+	Timestamp     time.Time `json:"timestamp"`
+	Size          int       `json:"size"`
+	ContentBase64 string    `json:"content_base64"`
+}
+
+// EnableHistoryFile keeps the history in path as JSON, loading the entries it already holds, within the
+// limits EnableHistory set, and saving the history again whenever it changes. Entries larger than
+// maxEntrySize (zero for no limit) are left out of the file, so big images don't make every save slow.
+// Call it after Init and EnableHistory.
+func EnableHistoryFile(path string, maxEntrySize int64) error {
+	if state == nil {
+		return fmt.Errorf("clipboard not initialized")
+	}
+	entries, err := readHistoryFile(path)
+	if err != nil {
+		return err
+	}
+
+	loaded := 0
+	state.mu.Lock()
+	for _, entry := range entries {
+		data, err := base64.StdEncoding.DecodeString(entry.ContentBase64)
+		if err != nil || len(data) != entry.Size {
+			logf("Skipping corrupt entry from %s in the history file", entry.Timestamp)
+			continue
+		}
+		if _, err := historyOf(entry.Register, true).record(entry.Format, data, entry.Timestamp); err != nil {
+			state.mu.Unlock()
+			return fmt.Errorf("could not load history file: %w", err)
+		}
+		loaded++
+	}
+	state.mu.Unlock()
+
+	historyFile = path
+	historyFileMaxEntry = maxEntrySize
+	logf("Loaded %d history entries from %s", loaded, path)
+	return nil
+}
+
+// readHistoryFile returns the entries saved in path, oldest first within each register, or none if it doesn't exist yet
+func readHistoryFile(path string) ([]historyFileEntry, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read history file: %w", err)
+	}
+	entries := []historyFileEntry{}
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("could not parse history file %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// saveHistory writes the history to the history file, if there is one
+func saveHistory() {
+	if historyFile == "" {
+		return
+	}
+	historyFileMu.Lock()
+	defer historyFileMu.Unlock()
+
+	state.mu.RLock()
+	registers := make([]string, 0, len(state.histories))
+	for register := range state.histories {
+		registers = append(registers, register)
+	}
+	sort.Strings(registers)
+	entries := []historyFileEntry{}
+	for _, register := range registers {
+		for _, item := range state.histories[register].items {
+			if historyFileMaxEntry > 0 && int64(item.Size) > historyFileMaxEntry {
+				continue
+			}
+			data, err := item.content()
+			if err != nil {
+				logf("Not saving history entry from %s: %v", item.Time, err)
+				continue
+			}
+			entries = append(entries, historyFileEntry{
+				Register:      register,
+				Format:        item.Format,
+				Timestamp:     item.Time,
+				Size:          item.Size,
+				ContentBase64: base64.StdEncoding.EncodeToString(data),
+			})
+		}
+	}
+	state.mu.RUnlock()
+
+	raw, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		logf("Failed to encode history: %v", err)
+		return
+	}
+	if err := util.WriteFileAtomic(historyFile, append(raw, '\n'), 0600); err != nil {
+		logf("Failed to save history to %s: %v", historyFile, err)
+	}
+}
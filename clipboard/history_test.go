@@ -0,0 +1,236 @@
+package clipboard
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useHistory enables history for the rest of the test
+func useHistory(t *testing.T, limit int, maxBytes int64) {
+	savedLimit, savedMaxBytes := historyLimit, historyMaxBytes
+	EnableHistory(limit, maxBytes)
+	t.Cleanup(func() { historyLimit, historyMaxBytes = savedLimit, savedMaxBytes })
+}
+
+// historyContents returns the remembered copies' content, newest first
+func historyContents(t *testing.T) []string {
+	t.Helper()
+	var contents []string
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	h := historyOf("", false)
+	if h == nil {
+		return nil
+	}
+	for i := len(h.items) - 1; i >= 0; i-- {
+		data, err := h.items[i].content()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, string(data))
+	}
+	return contents
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHistoryLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		maxBytes int64
+		copies   []string
+		want     []string
+	}{
+		{"count limit", 2, 0, []string{"a", "b", "c"}, []string{"c", "b"}},
+		{"byte limit", 10, 8, []string{"aaaa", "bbbb", "cccc"}, []string{"cccc", "bbbb"}},
+		{"both limits, count first", 2, 100, []string{"aa", "bb", "cc"}, []string{"cc", "bb"}},
+		{"both limits, bytes first", 3, 5, []string{"aa", "bb", "ccc"}, []string{"ccc", "bb"}},
+		{"copy over the byte limit skipped", 10, 4, []string{"aaaa", "bbbbb"}, []string{"aaaa"}},
+		{"repeated copy not duplicated", 10, 0, []string{"a", "a", "b", "a"}, []string{"a", "b", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestState(t, nil)
+			useHistory(t, tt.limit, tt.maxBytes)
+			for _, c := range tt.copies {
+				if err := Copy([]byte(c)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := historyContents(t); !equalStrings(got, tt.want) {
+				t.Errorf("history holds %q, want %q", got, tt.want)
+			}
+			var size int64
+			for _, entry := range History("") {
+				size += int64(entry.Size)
+			}
+			if h := historyOf("", false); h.bytes != size {
+				t.Errorf("history counts %d bytes, its entries hold %d", h.bytes, size)
+			}
+		})
+	}
+}
+
+func TestHistorySpill(t *testing.T) {
+	useTestState(t, nil)
+	useHistory(t, 2, 0)
+	savedThreshold := spillThreshold
+	EnableSpill(4)
+	t.Cleanup(func() { spillThreshold = savedThreshold })
+
+	for _, c := range []string{"spilled one", "tiny", "spilled two"} {
+		if err := Copy([]byte(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	state.mu.RLock()
+	items := append([]*historyItem(nil), historyOf("", false).items...)
+	state.mu.RUnlock()
+	if items[0].spillPath != "" || items[0].data == nil {
+		t.Errorf("entry %q under the threshold was spilled", items[0].Head)
+	}
+	spilled := items[1]
+	if spilled.spillPath == "" || spilled.data != nil {
+		t.Fatalf("entry %q over the threshold was kept in memory", spilled.Head)
+	}
+	if string(spilled.Head) != "spilled two" {
+		t.Errorf("spilled entry previews as %q", spilled.Head)
+	}
+
+	if err := RestoreHistory("", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Paste(); err != nil || string(got) != "spilled two" {
+		t.Errorf("restored spilled entry pastes as %q, %v", got, err)
+	}
+
+	// Dropping a spilled entry removes its file
+	if err := Copy([]byte("newer")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Copy([]byte("newest")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(spilled.spillPath); !os.IsNotExist(err) {
+		t.Errorf("spill file of dropped entry still exists: %v", err)
+	}
+	RemoveSpillFiles()
+}
+
+func TestHistoryFile(t *testing.T) {
+	useTestState(t, nil)
+	useHistory(t, 5, 0)
+	path := filepath.Join(t.TempDir(), "history.json")
+	t.Cleanup(func() { historyFile, historyFileMaxEntry = "", 0 })
+	if err := EnableHistoryFile(path, 8); err != nil {
+		t.Fatal(err)
+	}
+
+	binary := string([]byte{0, 0xff, '\n', 0x80})
+	for _, c := range []string{"first", binary, "too large for the file"} {
+		if err := Copy([]byte(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CopyRegister("notes", []byte("note")); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []historyFileEntry
+	if err := json.Unmarshal(raw, &saved); err != nil {
+		t.Fatalf("history file isn't JSON: %v\n%s", err, raw)
+	}
+	if len(saved) != 3 || saved[0].Register != "" || saved[2].Register != "notes" || saved[1].Size != len(binary) || saved[1].Timestamp.IsZero() {
+		t.Fatalf("history file holds %+v, want the copies within the entry limit", saved)
+	}
+
+	// A restarted server loads what was saved, keeping the timestamps
+	useTestState(t, nil)
+	if err := EnableHistoryFile(path, 8); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := historyContents(t), []string{binary, "first"}; !equalStrings(got, want) {
+		t.Errorf("reloaded history holds %q, want %q", got, want)
+	}
+	if entries := History(""); !entries[0].Time.Equal(saved[1].Timestamp) {
+		t.Errorf("reloaded entry has time %v, saved as %v", entries[0].Time, saved[1].Timestamp)
+	}
+	if entries := History("notes"); len(entries) != 1 || string(entries[0].Head) != "note" {
+		t.Errorf("reloaded register history holds %+v", entries)
+	}
+}
+
+func TestHistoryFileCorrupt(t *testing.T) {
+	useTestState(t, nil)
+	useHistory(t, 5, 0)
+	path := filepath.Join(t.TempDir(), "history.json")
+	if err := os.WriteFile(path, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnableHistoryFile(path, 0); err == nil {
+		t.Error("loading a history file that isn't JSON succeeded")
+	}
+}
+
+func TestClearForgetsHistory(t *testing.T) {
+	useTestState(t, nil)
+	useHistory(t, 5, 0)
+	path := filepath.Join(t.TempDir(), "history.json")
+	t.Cleanup(func() { historyFile, historyFileMaxEntry = "", 0 })
+	if err := EnableHistoryFile(path, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []string{"hunter2", "older", "hunter2"} {
+		if err := Copy([]byte(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := historyContents(t), []string{"older"}; !equalStrings(got, want) {
+		t.Errorf("history holds %q after clearing, want %q", got, want)
+	}
+	if data, err := os.ReadFile(path); err != nil || bytes.Contains(data, []byte(base64.StdEncoding.EncodeToString([]byte("hunter2")))) {
+		t.Errorf("history file still holds the cleared content (%v):\n%s", err, data)
+	}
+
+	if err := CopyRegister("notes", []byte("kept")); err != nil {
+		t.Fatal(err)
+	}
+	if err := CopyRegister("notes", []byte("hunter2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ClearRegister("notes"); err != nil {
+		t.Fatal(err)
+	}
+	if entries := History("notes"); len(entries) != 1 || string(entries[0].Head) != "kept" {
+		t.Errorf("register history holds %+v after clearing, want only %q", entries, "kept")
+	}
+	if err := RestoreHistory("", 0); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := Paste(); string(data) != "older" {
+		t.Errorf("restoring the newest entry after clearing pasted %q", data)
+	}
+}
@@ -0,0 +1,34 @@
+package clipboard
+
+import (
+	"bytes"
+	"time"
+)
+
+// managerCompatDelay is how long to wait before reading a write back; zero disables the check.
+var managerCompatDelay time.Duration
+
+// EnableManagerCompat makes copies to the system clipboard verify themselves: after delay the content
+// is read back and written once more if it changed. Clipboard managers known to race with writes this
+// way include CopyQ, GPaste, Klipper and Clipman.
+func EnableManagerCompat(delay time.Duration) {
+	managerCompatDelay = delay
+}
+
+// verifyCopy reads the clipboard back after managerCompatDelay and retries the write once
+// if a clipboard manager altered the content in the meantime.
+func verifyCopy(active clipboarder, data []byte) error {
+	time.Sleep(managerCompatDelay)
+
+	got, err := Paste()
+	if err != nil {
+		logf("Could not read clipboard back to verify copy: %v", err)
+		return nil
+	}
+	if bytes.Equal(got, data) {
+		return nil
+	}
+
+	logf("Clipboard content changed after write (wrote %d bytes, read back %d), likely a clipboard manager; retrying once", len(data), len(got))
+	return active.Copy(data)
+}
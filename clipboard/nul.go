@@ -0,0 +1,17 @@
+package clipboard
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// trimNullTerminator strips trailing NUL bytes from text, such as the terminator some Windows
+// clipboard formats carry, so round trips between platforms neither accumulate nor lose them.
+// Content with NUL bytes elsewhere or that isn't valid UTF-8 is binary and returned unchanged
+func trimNullTerminator(data []byte) []byte {
+	text := bytes.TrimRight(data, "\x00")
+	if len(text) == len(data) || bytes.IndexByte(text, 0) >= 0 || !utf8.Valid(text) {
+		return data
+	}
+	return text
+}
@@ -0,0 +1,73 @@
+package clipboard
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTrimNullTerminator(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", ""},
+		{"no terminator", "a", "a"},
+		{"terminated", "a\x00", "a"},
+		{"doubly terminated", "a\x00\x00", "a"},
+		{"terminated multibyte text", "héllo\n\x00", "héllo\n"},
+		{"only NULs", "\x00\x00", ""},
+		{"embedded NUL", "a\x00b", "a\x00b"},
+		{"embedded and trailing NUL", "a\x00b\x00", "a\x00b\x00"},
+		{"invalid UTF-8", "\xff\xfe\x00", "\xff\xfe\x00"},
+		{"PNG header", "\x89PNG\r\n\x1a\n\x00\x00", "\x89PNG\r\n\x1a\n\x00\x00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trimNullTerminator([]byte(tt.in)); !bytes.Equal(got, []byte(tt.want)) {
+				t.Errorf("trimNullTerminator(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNullTerminatorRoundTrip(t *testing.T) {
+	useTestState(t, nil)
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"terminated", "a\x00", "a"},
+		{"doubly terminated", "a\x00\x00", "a"},
+		{"not terminated", "a", "a"},
+		{"binary", "a\x00b\x00", "a\x00b\x00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Copy([]byte(tt.in)); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Paste()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, []byte(tt.want)) {
+				t.Errorf("copying %q pasted %q, want %q", tt.in, got, tt.want)
+			}
+
+			// Pasting what was pasted must not lose anything more
+			if err := Copy(got); err != nil {
+				t.Fatal(err)
+			}
+			again, err := Paste()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again, got) {
+				t.Errorf("second round trip of %q gave %q", got, again)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+//go:build linux && !android
+
+package clipboard
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// probeTimeout bounds how long probeSystemClipboard waits for the display server to accept a connection
+const probeTimeout = time.Second
+
+// probeSystemClipboard checks that the X display golang.design reads the clipboard from still accepts
+// connections. golang.design reads nothing both from an empty clipboard and when the display is gone,
+// and its Init only probes once, so a failed read is told apart by connecting to the display directly.
+func probeSystemClipboard() error {
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		return fmt.Errorf("DISPLAY is not set")
+	}
+	i := strings.LastIndex(display, ":")
+	if i < 0 {
+		return fmt.Errorf("invalid DISPLAY %q", display)
+	}
+	host := display[:i]
+	number, _, _ := strings.Cut(display[i+1:], ".")
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return fmt.Errorf("invalid DISPLAY %q", display)
+	}
+
+	var conn net.Conn
+	if host == "" || host == "unix" {
+		// X servers listen on a socket file and, on Linux, also on the abstract socket of the same name
+		path := "/tmp/.X11-unix/X" + strconv.Itoa(n)
+		if conn, err = net.DialTimeout("unix", path, probeTimeout); err != nil {
+			conn, err = net.DialTimeout("unix", "@"+path, probeTimeout)
+		}
+	} else {
+		conn, err = net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(6000+n)), probeTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("X display %s is unreachable: %w", display, err)
+	}
+	conn.Close()
+	return nil
+}
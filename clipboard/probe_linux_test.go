@@ -0,0 +1,38 @@
+//go:build linux && !android
+
+package clipboard
+
+import (
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestProbeSystemClipboard(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	if port < 6000 {
+		ln.Close()
+		t.Skipf("listener got port %d, below the X11 port range", port)
+	}
+	display := "127.0.0.1:" + strconv.Itoa(port-6000) + ".0"
+	t.Setenv("DISPLAY", display)
+
+	if err := probeSystemClipboard(); err != nil {
+		t.Errorf("probe of listening display %s failed: %v", display, err)
+	}
+	ln.Close()
+	if err := probeSystemClipboard(); err == nil {
+		t.Errorf("probe of closed display %s succeeded", display)
+	}
+
+	for _, bad := range []string{"", "nodisplay", "host:x"} {
+		t.Setenv("DISPLAY", bad)
+		if err := probeSystemClipboard(); err == nil {
+			t.Errorf("probe with DISPLAY=%q succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !android
+
+package clipboard
+
+// probeSystemClipboard reports whether the system clipboard is still usable. On macOS and Windows it
+// belongs to the session rather than to a display server that can go away, so it always is.
+func probeSystemClipboard() error {
+	return nil
+}
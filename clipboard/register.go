@@ -0,0 +1,92 @@
+package clipboard
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// registerStore holds named in-memory clipboards kept apart from the active clipboard
+type registerStore struct {
+	mu        sync.Mutex
+	registers map[string]*inMemoryClipboard
+}
+
+func newRegisterStore() *registerStore {
+	return &registerStore{registers: make(map[string]*inMemoryClipboard)}
+}
+
+// get returns the named register, creating it empty on first use
+func (s *registerStore) get(name string) *inMemoryClipboard {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reg, ok := s.registers[name]
+	if !ok {
+		reg = &inMemoryClipboard{}
+		s.registers[name] = reg
+	}
+	return reg
+}
+
+// lookup returns the named register, or nil if it was never written to
+func (s *registerStore) lookup(name string) *inMemoryClipboard {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.registers[name]
+}
+
+// names returns the names of every register written to, sorted
+func (s *registerStore) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.registers))
+	for name := range s.registers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CopyRegister writes data into the named register without touching the active clipboard
+func CopyRegister(name string, data []byte) error {
+	return CopyRegisterAs(name, FormatText, data)
+}
+
+// ClearRegister empties the named register and removes its content from the register's history.
+// Clearing isn't remembered in the history either.
+func ClearRegister(name string) error {
+	forgetCleared(name, func(format string) ([]byte, error) {
+		return PasteRegisterAs(name, format)
+	})
+	return copyRegisterAs(name, FormatText, nil, false)
+}
+
+// PasteRegister reads the named register; a register never written to is empty
+func PasteRegister(name string) ([]byte, error) {
+	return PasteRegisterAs(name, FormatText)
+}
+
+// RegisterSize returns the length of the named register's content without copying it
+func RegisterSize(name string) (int, error) {
+	if state == nil {
+		return 0, fmt.Errorf("clipboard not initialized")
+	}
+	reg := state.registers.lookup(name)
+	if reg == nil {
+		return 0, nil
+	}
+	return reg.Size()
+}
+
+// HasRegister reports whether the named register has been written to
+func HasRegister(name string) bool {
+	return state != nil && state.registers.lookup(name) != nil
+}
+
+// RegisterNames returns the names of every register written to, sorted
+func RegisterNames() []string {
+	if state == nil {
+		return nil
+	}
+	return state.registers.names()
+}
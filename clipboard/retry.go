@@ -0,0 +1,42 @@
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	retryAttempts int           // how many more times a failed system clipboard operation is tried
+	retryBackoff  time.Duration // wait before the first retry, doubled before each further one
+)
+
+// EnableRetry makes a failing system clipboard operation be retried up to attempts more times before
+// switching to the fallback, waiting backoff before the first retry and twice as long before each further
+// one. It rides out transient failures such as another application briefly holding the clipboard. Retries
+// count against the operation's timeout: once it passes and the fallback has taken over, retrying stops.
+func EnableRetry(attempts int, backoff time.Duration) {
+	retryAttempts = attempts
+	retryBackoff = backoff
+}
+
+// withRetry runs op, retrying it as configured by EnableRetry until ctx is done. Content missing in
+// the requested format is an answer, not a failure, so it is never retried. A retry after ctx is done
+// could write content that is stale by then, as newer content already went to the fallback.
+func withRetry(ctx context.Context, name string, op func() error) error {
+	attempts, delay := retryAttempts, retryBackoff
+	err := op()
+	for i := 0; i < attempts && err != nil && !errors.Is(err, ErrTargetUnavailable); i++ {
+		logf("%s clipboard operation failed, retrying in %v: %v", name, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+		err = op()
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package clipboard
+
+import (
+	"testing"
+	"time"
+)
+
+// useRetry enables retries for the rest of the test
+func useRetry(t *testing.T, attempts int) {
+	savedAttempts, savedBackoff := retryAttempts, retryBackoff
+	EnableRetry(attempts, time.Millisecond)
+	t.Cleanup(func() { retryAttempts, retryBackoff = savedAttempts, savedBackoff })
+}
+
+func TestRetryAbsorbsTransientFailures(t *testing.T) {
+	system := &fakeClipboard{}
+	useTestState(t, system)
+	useRetry(t, 3)
+
+	system.setFailures(2)
+	if err := Copy([]byte("retried")); err != nil {
+		t.Fatalf("copy failing twice with 3 retries: %v", err)
+	}
+	if calls := system.callCount(); calls != 3 {
+		t.Errorf("copy took %d attempts, want 3", calls)
+	}
+
+	system.setFailures(3)
+	got, err := Paste()
+	if err != nil {
+		t.Fatalf("paste failing three times with 3 retries: %v", err)
+	}
+	if string(got) != "retried" {
+		t.Errorf("pasted %q, want %q", got, "retried")
+	}
+	if calls := system.callCount(); calls != 4 {
+		t.Errorf("paste took %d attempts, want 4", calls)
+	}
+
+	if IsUsingFallback() {
+		t.Error("switched to the fallback although retries absorbed every failure")
+	}
+	if n := healthChecks.Load(); n != 0 {
+		t.Errorf("%d health checks started although nothing fell back", n)
+	}
+}
+
+func TestRetryExhaustedFallsBack(t *testing.T) {
+	system := &fakeClipboard{}
+	useTestState(t, system)
+	useRetry(t, 2)
+	clipboardResponsive = func() bool { return false }
+
+	system.setFailures(3)
+	if err := Copy([]byte("fallback")); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if calls := system.callCount(); calls != 3 {
+		t.Errorf("copy took %d attempts, want 3", calls)
+	}
+	if !IsUsingFallback() {
+		t.Fatal("still on the system clipboard after every retry failed")
+	}
+	if got, err := Paste(); err != nil || string(got) != "fallback" {
+		t.Errorf("paste from fallback = %q, %v; want %q", got, err, "fallback")
+	}
+}
+
+func TestRetryStopsAtTimeout(t *testing.T) {
+	system := &fakeClipboard{}
+	useTestState(t, system)
+	useRetry(t, 5)
+	retryBackoff = 50 * time.Millisecond
+	clipboardTimeout = 10 * time.Millisecond
+	clipboardResponsive = func() bool { return false }
+
+	system.setFailures(1)
+	if err := Copy([]byte("stale")); err != nil {
+		t.Fatal(err)
+	}
+	if !IsUsingFallback() {
+		t.Fatal("still on the system clipboard after the copy timed out")
+	}
+
+	// A retry after the timeout would land here and put content the fallback already took into the system clipboard
+	time.Sleep(4 * retryBackoff)
+	if calls := system.callCount(); calls != 1 {
+		t.Errorf("system clipboard tried %d times, want no retry once the copy timed out", calls)
+	}
+	if data, _ := system.Paste(); len(data) != 0 {
+		t.Errorf("system clipboard got %q after the copy had fallen back", data)
+	}
+}
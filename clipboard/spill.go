@@ -0,0 +1,115 @@
+package clipboard
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// spillThreshold is the size above which in-memory clipboards keep their content in a temp file; zero disables spilling.
+var spillThreshold int64
+
+// spillDir holds every spill file of this process, created on first spill so RemoveSpillFiles can delete them all at once
+var spillDir struct {
+	mu   sync.Mutex
+	path string
+}
+
+// EnableSpill makes in-memory clipboards store content larger than threshold bytes in a temp file
+// instead of RAM, so huge payloads don't stay resident between copy and paste
+func EnableSpill(threshold int64) {
+	spillThreshold = threshold
+}
+
+// spill writes data to a new temp file and returns its path
+func spill(data []byte) (string, error) {
+	spillDir.mu.Lock()
+	if spillDir.path == "" {
+		dir, err := os.MkdirTemp("", "pb-spill-*")
+		if err != nil {
+			spillDir.mu.Unlock()
+			return "", fmt.Errorf("could not create spill directory: %w", err)
+		}
+		spillDir.path = dir
+	}
+	dir := spillDir.path
+	spillDir.mu.Unlock()
+
+	f, err := os.CreateTemp(dir, "pb-clipboard-*")
+	if err != nil {
+		return "", fmt.Errorf("could not create spill file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("could not write spill file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("could not write spill file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// RemoveSpillFiles deletes the temp files holding spilled clipboard and history content.
+// Call it once the clipboard is no longer used, such as on shutdown: spilled content is gone afterwards.
+func RemoveSpillFiles() error {
+	spillDir.mu.Lock()
+	defer spillDir.mu.Unlock()
+	if spillDir.path == "" {
+		return nil
+	}
+	err := os.RemoveAll(spillDir.path)
+	spillDir.path = ""
+	return err
+}
+
+// OpenSpilled opens the content of the active in-memory clipboard, or of the named register if register is set,
+// for streaming when it was spilled to a temp file and is in the given format.
+// It returns a nil reader when the content is not spilled, in which case it is read with PasteAs or PasteRegisterAs.
+func OpenSpilled(register, format string) (io.ReadCloser, int64, error) {
+	if err := checkFormat(format); err != nil {
+		return nil, 0, err
+	}
+	if state == nil {
+		return nil, 0, fmt.Errorf("clipboard not initialized")
+	}
+
+	var c *inMemoryClipboard
+	switch {
+	case register != "":
+		c = state.registers.lookup(register)
+	case isUsingFallback():
+		c = state.fallback
+	}
+	if c == nil {
+		return nil, 0, nil
+	}
+	return c.openSpilled(format)
+}
+
+// openSpilled opens the spill file if the content is spilled and in the given format.
+// The open file keeps its content readable even if a copy replaces and removes it meanwhile.
+func (c *inMemoryClipboard) openSpilled(format string) (io.ReadCloser, int64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	stored := c.format
+	if stored == "" {
+		stored = FormatText
+	}
+	if c.spillPath == "" || stored != format {
+		return nil, 0, nil
+	}
+
+	f, err := os.Open(c.spillPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
@@ -0,0 +1,52 @@
+package clipboard
+
+import (
+	"sync"
+)
+
+// writeMu serialises writes that must not be split by another one, such as a copy checking If-Match
+// first, or an expired copy being cleared
+var writeMu sync.Mutex
+
+// LockWrites holds off other callers of LockWrites, and the clearing of expired content, until UnlockWrites.
+// Hold it around a Version check and the write it guards.
+func LockWrites() {
+	writeMu.Lock()
+}
+
+// UnlockWrites releases LockWrites
+func UnlockWrites() {
+	writeMu.Unlock()
+}
+
+// versionCounter counts the writes to each register, "" being the active clipboard
+type versionCounter struct {
+	mu       sync.Mutex
+	versions map[string]uint64
+}
+
+// Version returns a counter bumped by every write through this package to the named register, or to
+// the active clipboard if register is "", so callers can tell whether it was written since they last read.
+// Each register counts on its own, so writes to one don't show in the version of another.
+// Changes made to the system clipboard by other programs are not counted
+func Version(register string) uint64 {
+	if state == nil {
+		return 0
+	}
+	state.version.mu.Lock()
+	defer state.version.mu.Unlock()
+	return state.version.versions[register]
+}
+
+// bumpVersionOnSuccess bumps the version of register when the write that returned err succeeded
+func bumpVersionOnSuccess(register string, err error) error {
+	if err == nil {
+		state.version.mu.Lock()
+		defer state.version.mu.Unlock()
+		if state.version.versions == nil {
+			state.version.versions = map[string]uint64{}
+		}
+		state.version.versions[register]++
+	}
+	return err
+}
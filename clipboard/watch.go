@@ -0,0 +1,136 @@
+package clipboard
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// watchInterval is how often change detection reads the clipboard
+var watchInterval = 500 * time.Millisecond
+
+// watcherRegistry fans clipboard changes out to subscribers.
+// A single poller runs while at least one watcher is subscribed, so N watchers don't each poll.
+type watcherRegistry struct {
+	mu       sync.Mutex
+	watchers map[chan []byte]WatcherInfo
+	stop     chan struct{}  // closed to stop the poller, nil when it isn't running
+	pollers  sync.WaitGroup // pollers that haven't returned yet, a stopped one included
+}
+
+// WatcherInfo describes a subscribed watcher
+type WatcherInfo struct {
+	Owner string    // who subscribed, e.g. a key fingerprint
+	Since time.Time // when it subscribed
+}
+
+func newWatcherRegistry() *watcherRegistry {
+	return &watcherRegistry{watchers: make(map[chan []byte]WatcherInfo)}
+}
+
+// Subscribe registers a watcher that receives the clipboard content each time it changes.
+// Owner identifies the subscriber in Watchers. The returned function unsubscribes the watcher and closes its channel.
+func Subscribe(owner string) (<-chan []byte, func(), error) {
+	if state == nil {
+		return nil, nil, fmt.Errorf("clipboard not initialized")
+	}
+	reg := state.watchers
+
+	ch := make(chan []byte, 1)
+	reg.mu.Lock()
+	reg.watchers[ch] = WatcherInfo{Owner: owner, Since: time.Now()}
+	if reg.stop == nil {
+		reg.stop = make(chan struct{})
+		reg.pollers.Add(1)
+		go reg.poll(reg.stop)
+		logf("Started clipboard change detection (polling every %v)", watchInterval)
+	}
+	reg.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() { reg.unsubscribe(ch) })
+	}
+	return ch, unsubscribe, nil
+}
+
+// Watchers returns the subscribed watchers, oldest first, and whether change detection is polling for them
+func Watchers() ([]WatcherInfo, bool) {
+	if state == nil {
+		return nil, false
+	}
+	reg := state.watchers
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	infos := make([]WatcherInfo, 0, len(reg.watchers))
+	for _, info := range reg.watchers {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Since.Before(infos[j].Since) })
+	return infos, reg.stop != nil
+}
+
+// unsubscribe removes a watcher and stops the poller once nobody is left.
+func (reg *watcherRegistry) unsubscribe(ch chan []byte) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	delete(reg.watchers, ch)
+	close(ch)
+	if len(reg.watchers) == 0 && reg.stop != nil {
+		close(reg.stop)
+		reg.stop = nil
+		logf("Stopped clipboard change detection")
+	}
+}
+
+// poll reads the clipboard on an interval and broadcasts its content whenever the hash changes.
+func (reg *watcherRegistry) poll(stop chan struct{}) {
+	defer reg.pollers.Done()
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	var last [sha256.Size]byte
+	if data, err := Paste(); err == nil {
+		last = sha256.Sum256(data)
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			data, err := Paste()
+			if err != nil {
+				logf("Change detection failed to read clipboard: %v", err)
+				continue
+			}
+			if sum := sha256.Sum256(data); sum != last {
+				last = sum
+				reg.broadcast(data)
+			}
+		}
+	}
+}
+
+// broadcast delivers data to every watcher. A slow watcher only ever holds the latest content.
+func (reg *watcherRegistry) broadcast(data []byte) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	for ch := range reg.watchers {
+		select {
+		case ch <- data:
+		default:
+			// Drop the stale value; only the poller sends, so there is room afterwards
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- data
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package clipboard
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// useFastWatch makes change detection poll every millisecond for the rest of the test
+func useFastWatch(t *testing.T) {
+	saved := watchInterval
+	watchInterval = time.Millisecond
+	t.Cleanup(func() {
+		// Stopped pollers may still be finishing a read
+		state.watchers.pollers.Wait()
+		watchInterval = saved
+	})
+}
+
+// receive returns the next value ch delivers, failing the test if none arrives in time
+func receive(t *testing.T, ch <-chan []byte) []byte {
+	t.Helper()
+	select {
+	case data := <-ch:
+		return data
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a clipboard change")
+		return nil
+	}
+}
+
+func TestWatchOnePollerForManyWatchers(t *testing.T) {
+	useTestState(t, nil)
+	useFastWatch(t)
+	reg := state.watchers
+
+	const n = 5
+	channels := make([]<-chan []byte, n)
+	var poller chan struct{}
+	for i := range channels {
+		ch, unsubscribe, err := Subscribe(fmt.Sprintf("watcher %d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unsubscribe()
+		channels[i] = ch
+
+		reg.mu.Lock()
+		stop := reg.stop
+		reg.mu.Unlock()
+		if i == 0 {
+			poller = stop
+		} else if stop != poller {
+			t.Fatalf("subscribing watcher %d started another poller", i)
+		}
+	}
+	if infos, polling := Watchers(); len(infos) != n || !polling {
+		t.Fatalf("Watchers() = %d watchers, polling %v; want %d, true", len(infos), polling, n)
+	}
+
+	// The poller takes the content at subscription as its baseline, so give it time to read it first
+	time.Sleep(20 * time.Millisecond)
+	if err := Copy([]byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	for i, ch := range channels {
+		if got := receive(t, ch); string(got) != "changed" {
+			t.Errorf("watcher %d got %q, want %q", i, got, "changed")
+		}
+	}
+}
+
+func TestWatchDeliversChangeOnce(t *testing.T) {
+	useTestState(t, nil)
+	useFastWatch(t)
+
+	ch, unsubscribe, err := Subscribe("watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+
+	// The poller takes the content at subscription as its baseline, so give it time to read it first
+	time.Sleep(20 * time.Millisecond)
+	if err := Copy([]byte("once")); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, ch); string(got) != "once" {
+		t.Fatalf("got %q, want %q", got, "once")
+	}
+
+	// Copying the same content again is no change either
+	if err := Copy([]byte("once")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-ch:
+		t.Fatalf("unchanged clipboard delivered again: %q", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatchSlowWatcherHoldsLatest(t *testing.T) {
+	useTestState(t, nil)
+	reg := newWatcherRegistry()
+	ch := make(chan []byte, 1)
+	reg.watchers[ch] = WatcherInfo{Owner: "slow"}
+
+	// A watcher that reads nothing must neither block broadcasting nor queue stale content
+	for _, data := range []string{"first", "second", "third"} {
+		reg.broadcast([]byte(data))
+	}
+	if got := <-ch; string(got) != "third" {
+		t.Errorf("slow watcher got %q, want the latest %q", got, "third")
+	}
+	select {
+	case data := <-ch:
+		t.Errorf("slow watcher held stale content %q as well", data)
+	default:
+	}
+}
+
+func TestWatchPollerStopsAfterLastUnsubscribe(t *testing.T) {
+	useTestState(t, nil)
+	useFastWatch(t)
+	reg := state.watchers
+
+	ch1, unsubscribe1, err := Subscribe("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch2, unsubscribe2, err := Subscribe("second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.mu.Lock()
+	poller := reg.stop
+	reg.mu.Unlock()
+
+	unsubscribe1()
+	if _, polling := Watchers(); !polling {
+		t.Fatal("poller stopped while a watcher was still subscribed")
+	}
+	if _, open := <-ch1; open {
+		t.Error("unsubscribed watcher's channel was not closed")
+	}
+
+	unsubscribe2()
+	unsubscribe2() // unsubscribing twice is harmless
+	if infos, polling := Watchers(); len(infos) != 0 || polling {
+		t.Fatalf("after the last unsubscribe Watchers() = %d watchers, polling %v; want 0, false", len(infos), polling)
+	}
+	select {
+	case <-poller:
+	default:
+		t.Fatal("poller was not told to stop")
+	}
+	if _, open := <-ch2; open {
+		t.Error("last watcher's channel was not closed")
+	}
+
+	// A new subscriber starts a new poller
+	_, unsubscribe3, err := Subscribe("third")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe3()
+	if _, polling := Watchers(); !polling {
+		t.Error("subscribing after the poller stopped didn't start a new one")
+	}
+}
@@ -9,14 +9,43 @@ import (
 	"path/filepath"
 	"pb/util"
 	"strings"
+	"time"
+)
+
+var (
+	keyLabel     string
+	keysFromFile string
+	keyExpire    time.Duration
 )
 
 var addKeyCmd = &cobra.Command{
 	Use:   "key-add [public key string]",
 	Short: "Adds a public key to the server's authorized_keys",
-	Long:  fmt.Sprintf(`Appends a given public key to the ~/.config/%s/authorized_keys file. The key can be provided as an argument or via standard input.`, util.ProgramName),
-	Args:  cobra.MaximumNArgs(1),
+	Long: fmt.Sprintf(`Appends a given public key to the authorized_keys file in the config directory (~/.config/%s/ by default). The key can be provided as an argument, via standard input, or in bulk with --from-file.
+Adding a key that is already authorized with an expiry-time again with --expire renews its expiry instead.`, util.ProgramName),
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if keysFromFile != "" && len(args) == 1 {
+			return withExitCode(ExitInvalidInput, fmt.Errorf("cannot use a public key argument together with --from-file"))
+		}
+
+		configDir, err := util.ConfigDir()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(configDir, 0700); err != nil {
+			return fmt.Errorf("could not create config directory: %w", err)
+		}
+		authKeysPath := filepath.Join(configDir, "authorized_keys")
+
+		if keyExpire < 0 {
+			return withExitCode(ExitInvalidInput, fmt.Errorf("--expire must be a positive duration"))
+		}
+
+		if keysFromFile != "" {
+			return addKeysFromFile(authKeysPath, keysFromFile)
+		}
+
 		var keyToAdd string
 		if len(args) == 1 {
 			keyToAdd = args[0]
@@ -29,25 +58,36 @@ var addKeyCmd = &cobra.Command{
 		}
 
 		keyToAdd = strings.TrimSpace(keyToAdd)
-		if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(keyToAdd)); err != nil {
-			return fmt.Errorf("invalid public key provided: %w", err)
+		pubKey, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(keyToAdd))
+		if err != nil {
+			return withExitCode(ExitInvalidInput, fmt.Errorf("invalid public key provided: %w", err))
 		}
 
-		home, _ := os.UserHomeDir()
-		configDir := filepath.Join(home, ".config", util.ProgramName)
-		if err := os.MkdirAll(configDir, 0700); err != nil {
-			return fmt.Errorf("could not create config directory: %w", err)
+		authorized, err := authorizedFingerprints(authKeysPath)
+		if err != nil {
+			return err
+		}
+		if fingerprint := ssh.FingerprintSHA256(pubKey); authorized[fingerprint] {
+			if keyExpire > 0 {
+				renewed, err := renewKeyExpiry(authKeysPath, map[string]bool{fingerprint: true})
+				if err != nil {
+					return err
+				}
+				if renewed > 0 {
+					fmt.Printf("Renewed key %s in %s, it now expires in %s (restart a running server to apply it)\n", fingerprint, authKeysPath, keyExpire)
+					return nil
+				}
+			}
+			fmt.Printf("Key %s is already authorized in %s\n", fingerprint, authKeysPath)
+			return nil
 		}
 
-		authKeysPath := filepath.Join(configDir, "authorized_keys")
-		f, err := os.OpenFile(authKeysPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
-		if err != nil {
-			return fmt.Errorf("could not open authorized_keys file: %w", err)
+		if keyLabel != "" || keyExpire > 0 {
+			keyToAdd = decorateKey(pubKey, comment, options)
 		}
-		defer f.Close()
 
-		if _, err := f.WriteString(keyToAdd + "\n"); err != nil {
-			return fmt.Errorf("failed to write to authorized_keys file: %w", err)
+		if err := appendAuthorizedKeys(authKeysPath, []string{keyToAdd}); err != nil {
+			return err
 		}
 
 		fmt.Printf("Successfully added key to %s\n", authKeysPath)
@@ -55,6 +95,181 @@ var addKeyCmd = &cobra.Command{
 	},
 }
 
+// addKeysFromFile adds every valid public key in path, one per line, skipping keys that are already authorized.
+func addKeysFromFile(authKeysPath, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read keys file: %w", err)
+	}
+
+	authorized, err := authorizedFingerprints(authKeysPath)
+	if err != nil {
+		return err
+	}
+
+	var keysToAdd []string
+	duplicates, invalid := 0, 0
+	toRenew := make(map[string]bool)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pubKey, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			// Warn but continue, in case of a malformed line
+			fmt.Fprintf(os.Stderr, "Skipping line %d of %s: %v\n", i+1, path, err)
+			invalid++
+			continue
+		}
+
+		fingerprint := ssh.FingerprintSHA256(pubKey)
+		if authorized[fingerprint] {
+			if keyExpire > 0 {
+				toRenew[fingerprint] = true
+			}
+			duplicates++
+			continue
+		}
+		authorized[fingerprint] = true
+
+		if keyLabel != "" || keyExpire > 0 {
+			line = decorateKey(pubKey, comment, options)
+		}
+		keysToAdd = append(keysToAdd, line)
+	}
+
+	if err := appendAuthorizedKeys(authKeysPath, keysToAdd); err != nil {
+		return err
+	}
+	renewed := 0
+	if len(toRenew) > 0 {
+		if renewed, err = renewKeyExpiry(authKeysPath, toRenew); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Added %d keys to %s (%d duplicates skipped, %d of them renewed, %d invalid lines)\n", len(keysToAdd), authKeysPath, duplicates, renewed, invalid)
+	return nil
+}
+
+// renewKeyExpiry rewrites the authorized_keys lines of the given keys that carry an expiry-time option,
+// applying --expire (and --label) to them. Keys without an expiry are left alone, since renewing them would
+// start limiting their access. It returns how many lines were rewritten.
+func renewKeyExpiry(authKeysPath string, fingerprints map[string]bool) (int, error) {
+	data, err := os.ReadFile(authKeysPath)
+	if err != nil {
+		return 0, fmt.Errorf("could not read authorized_keys file: %w", err)
+	}
+
+	// Work line by line so comments and lines we can't parse are kept as they are
+	lines := strings.SplitAfter(string(data), "\n")
+	renewed := 0
+	for i, line := range lines {
+		pubKey, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil || !fingerprints[ssh.FingerprintSHA256(pubKey)] || !hasExpiryTime(options) {
+			continue
+		}
+		lines[i] = decorateKey(pubKey, comment, options) + "\n"
+		renewed++
+	}
+	if renewed == 0 {
+		return 0, nil
+	}
+
+	if err := util.WriteFileAtomic(authKeysPath, []byte(strings.Join(lines, "")), 0600); err != nil {
+		return 0, fmt.Errorf("could not rewrite authorized_keys file: %w", err)
+	}
+	return renewed, nil
+}
+
+// hasExpiryTime reports whether authorized_keys options include expiry-time, which like OpenSSH is matched
+// case-insensitively.
+func hasExpiryTime(options []string) bool {
+	for _, opt := range options {
+		if name, _, _ := strings.Cut(opt, "="); strings.EqualFold(name, util.OptionExpiryTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizedFingerprints returns the fingerprints of the keys already present in the authorized_keys file.
+func authorizedFingerprints(authKeysPath string) (map[string]bool, error) {
+	fingerprints := make(map[string]bool)
+
+	bytes, err := os.ReadFile(authKeysPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fingerprints, nil
+		}
+		return nil, fmt.Errorf("could not read authorized_keys file: %w", err)
+	}
+
+	for len(bytes) > 0 {
+		pubKey, _, _, rest, err := ssh.ParseAuthorizedKey(bytes)
+		if err != nil {
+			break
+		}
+		fingerprints[ssh.FingerprintSHA256(pubKey)] = true
+		bytes = rest
+	}
+	return fingerprints, nil
+}
+
+// appendAuthorizedKeys appends the given lines to the authorized_keys file, creating it if needed.
+func appendAuthorizedKeys(authKeysPath string, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(authKeysPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open authorized_keys file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		return fmt.Errorf("failed to write to authorized_keys file: %w", err)
+	}
+	return nil
+}
+
+// decorateKey applies --label and --expire to a parsed key and returns its authorized_keys line.
+// The label replaces whatever comment the key came with.
+func decorateKey(pubKey ssh.PublicKey, comment string, options []string) string {
+	if keyLabel != "" {
+		comment = keyLabel
+	}
+	if keyExpire > 0 {
+		expiry := time.Now().Add(keyExpire).UTC().Format(util.ExpiryTimeLayout)
+		var kept []string
+		for _, opt := range options {
+			if !hasExpiryTime([]string{opt}) {
+				kept = append(kept, opt)
+			}
+		}
+		options = append(kept, fmt.Sprintf("%s=%q", util.OptionExpiryTime, expiry))
+	}
+	return authorizedKeyLine(pubKey, options, comment)
+}
+
+// authorizedKeyLine formats a public key as an authorized_keys line with the given options and comment.
+func authorizedKeyLine(pubKey ssh.PublicKey, options []string, comment string) string {
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pubKey)))
+	if len(options) > 0 {
+		line = strings.Join(options, ",") + " " + line
+	}
+	if comment != "" {
+		line += " " + comment
+	}
+	return line
+}
+
 func init() {
 	rootCmd.AddCommand(addKeyCmd)
+	addKeyCmd.Flags().StringVar(&keyLabel, "label", "", "label stored as the key's comment, replacing any existing comment")
+	addKeyCmd.Flags().DurationVar(&keyExpire, "expire", 0, "stop accepting the key after this duration (e.g. 24h); renews an already authorized key that has an expiry")
+	addKeyCmd.Flags().StringVar(&keysFromFile, "from-file", "", "add every public key listed in a file, one per line")
 }
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"golang.org/x/crypto/ssh"
+	"os"
+	"path/filepath"
+	"pb/util"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPublicKey generates a key pair in a temp dir and returns its authorized_keys line and fingerprint
+func testPublicKey(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := util.GenerateSSHKeys(dir); err != nil {
+		t.Fatal(err)
+	}
+	line, err := os.ReadFile(filepath.Join(dir, "id_ed25519.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pubKey))), ssh.FingerprintSHA256(pubKey)
+}
+
+func TestRenewKeyExpiry(t *testing.T) {
+	expiring, expiringFingerprint := testPublicKey(t)
+	permanent, permanentFingerprint := testPublicKey(t)
+	original := "# team keys\n" +
+		`no-pty,expiry-time="20200101000000Z" ` + expiring + " alice@laptop\n" +
+		permanent + " bob@desktop\n"
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+	if err := os.WriteFile(path, []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := keyExpire
+	keyExpire = 24 * time.Hour
+	defer func() { keyExpire = saved }()
+
+	renewed, err := renewKeyExpiry(path, map[string]bool{expiringFingerprint: true, permanentFingerprint: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed != 1 {
+		t.Errorf("renewed %d keys, want only the one with an expiry", renewed)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(lines) != 4 || lines[0] != "# team keys" || lines[2] != permanent+" bob@desktop" || lines[3] != "" {
+		t.Fatalf("lines other than the renewed key changed:\n%s", data)
+	}
+	_, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(lines[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comment != "alice@laptop" || len(options) != 2 || options[0] != "no-pty" {
+		t.Errorf("renewal lost the key's comment or other options: %q", lines[1])
+	}
+	expiry := strings.Trim(strings.TrimPrefix(options[1], util.OptionExpiryTime+"="), `"`)
+	expiresAt, err := time.Parse(util.ExpiryTimeLayout, expiry)
+	if err != nil {
+		t.Fatalf("renewed line has expiry option %q: %v", options[1], err)
+	}
+	if until := time.Until(expiresAt); until < 23*time.Hour || until > 24*time.Hour {
+		t.Errorf("renewed key expires in %s, want about 24h", until)
+	}
+}
@@ -0,0 +1,82 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"net"
+	"os"
+	"sync"
+)
+
+// agentFingerprint selects the ssh-agent key to sign with, set by --fingerprint.
+var agentFingerprint string
+
+// agentKeyPrefix marks a key held only by ssh-agent, named by its fingerprint, where a key path is expected.
+const agentKeyPrefix = "agent:"
+
+var (
+	agentOnce    sync.Once
+	agentSigners []ssh.Signer
+)
+
+// loadAgentSigners returns the keys held by the ssh-agent at SSH_AUTH_SOCK, or none if there is no agent.
+// The connection stays open for the rest of the run, since the signers sign through it.
+func loadAgentSigners() []ssh.Signer {
+	agentOnce.Do(func() {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return
+		}
+		signers, err := agent.NewClient(conn).Signers()
+		if err != nil {
+			conn.Close()
+			return
+		}
+		agentSigners = signers
+	})
+	return agentSigners
+}
+
+// agentSignerByFingerprint returns the ssh-agent key with the given SHA256 fingerprint.
+func agentSignerByFingerprint(fingerprint string) (ssh.Signer, error) {
+	signers := loadAgentSigners()
+	if len(signers) == 0 {
+		return nil, withExitCode(ExitAuth, fmt.Errorf("key %s must come from ssh-agent, but no agent holding keys was found at SSH_AUTH_SOCK", fingerprint))
+	}
+	for _, signer := range signers {
+		if ssh.FingerprintSHA256(signer.PublicKey()) == fingerprint {
+			return signer, nil
+		}
+	}
+	return nil, withExitCode(ExitAuth, fmt.Errorf("ssh-agent holds no key with fingerprint %s, list its keys with 'ssh-add -l'", fingerprint))
+}
+
+// agentSignerForFile returns the ssh-agent signer for the key at path, recognized by the public key
+// next to it, or nil if the agent doesn't hold it. Signing through the agent needs no passphrase, and is
+// the only way to use hardware-backed keys such as sk-ed25519, whose file is just a handle.
+func agentSignerForFile(path string) ssh.Signer {
+	signers := loadAgentSigners()
+	if len(signers) == 0 {
+		return nil
+	}
+	pubKeyBytes, err := os.ReadFile(path + ".pub")
+	if err != nil {
+		return nil
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(pubKeyBytes)
+	if err != nil {
+		return nil
+	}
+	for _, signer := range signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), pubKey.Marshal()) {
+			return signer
+		}
+	}
+	return nil
+}
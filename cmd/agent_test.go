@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"net"
+	"os"
+	"path/filepath"
+	"pb/util"
+	"sync"
+	"testing"
+)
+
+// useTestAgent serves an ssh-agent holding a fresh key at SSH_AUTH_SOCK for the rest of the test and
+// returns the key's fingerprint
+func useTestAgent(t *testing.T) string {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: priv}); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", socket)
+
+	// The agent's keys are loaded once per run, so start over for this agent and after it
+	agentOnce, agentSigners = sync.Once{}, nil
+	t.Cleanup(func() {
+		ln.Close()
+		agentOnce, agentSigners = sync.Once{}, nil
+	})
+
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ssh.FingerprintSHA256(signer.PublicKey())
+}
+
+// TestGetSignerDiscoversPastAgent checks that an ssh-agent key the server rejects doesn't shadow an
+// authorized key on disk, and that the agent's first key is still used when there is no key on disk
+func TestGetSignerDiscoversPastAgent(t *testing.T) {
+	agentKey := useTestAgent(t)
+	fileKey, err := keyFingerprint(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := keyPath
+	defer func() { keyPath = saved }()
+	tests := []struct {
+		name    string
+		keyPath string
+		onDisk  bool
+		want    string
+	}{
+		{"authorized key on disk over a rejected agent key", "", true, fileKey},
+		{"agent key without keys on disk", "", false, agentKey},
+		{"--key over the agent", saved, false, fileKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			if tt.onDisk {
+				sshDir := filepath.Join(home, ".ssh")
+				if err := os.Mkdir(sshDir, 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(sshDir, "id_ed25519"), authorized, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			useFreshDiscovery(t)
+
+			keyPath = tt.keyPath
+			signer, err := getSigner()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ssh.FingerprintSHA256(signer.PublicKey()); got != tt.want {
+				t.Errorf("signed with %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// useFreshDiscovery makes key discovery run again for this test, without an earlier run's cached choice
+func useFreshDiscovery(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		discoveryOnce, discoveredKey = sync.Once{}, ""
+		if cachePath, err := util.ConfigPath(activeKeyFile); err == nil {
+			os.Remove(cachePath)
+		}
+	}
+	reset()
+	t.Cleanup(reset)
+}
@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"pb/util"
+)
+
+var backupTo string
+
+var backupCmd = &cobra.Command{
+	Use:   "backup --to <path>",
+	Short: "Saves the server's clipboard to a file on the server",
+	Long: fmt.Sprintf(`Makes the remote %s server write its clipboard content to a file on its own filesystem, for archiving.
+The path is relative to the directory the server was started with --backup-dir, and cannot leave it. An existing file is overwritten.`, util.ProgramName),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		result, err := doHTTPSRequest("POST", serverURL(util.RequestBackup), backupTo)
+		if err != nil {
+			return err
+		}
+		fmt.Print(result)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	backupCmd.Flags().StringVar(&backupTo, "to", "", "file to write, relative to the server's --backup-dir")
+	backupCmd.Flags().StringVar(&namespace, "namespace", "", "team namespace on the server; its registers are kept apart from other namespaces")
+	backupCmd.Flags().StringVar(&register, "register", "", fmt.Sprintf("register to back up (%q selects the shared clipboard on a --per-key-clipboard server)", util.RegisterShared))
+	backupCmd.MarkFlagRequired("to")
+}
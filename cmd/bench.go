@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"pb/clipboard"
+	"pb/util"
+	"slices"
+	"time"
+)
+
+var (
+	benchCount int
+	benchSize  int
+	benchJSON  bool
+)
+
+// benchResult summarizes the measured round trips, in milliseconds.
+type benchResult struct {
+	Count  int     `json:"count"`
+	Size   int     `json:"size"`
+	MinMs  float64 `json:"min_ms"`
+	MaxMs  float64 `json:"max_ms"`
+	MeanMs float64 `json:"mean_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+}
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measures clipboard round-trip latency against the server",
+	Long: fmt.Sprintf(`Copies random data to the remote %s server and pastes it back --count times, then reports the min, max, mean and 95th percentile round-trip latency.
+Each round trip goes through the real signed request path and the server's clipboard backend. The clipboard content is restored afterwards.`, util.ProgramName),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if benchCount < 1 || benchSize < 0 {
+			return withExitCode(ExitInvalidInput, fmt.Errorf("--count must be at least 1 and --size must not be negative"))
+		}
+
+		original, err := doHTTPSRequest("GET", serverURL(util.RequestPaste), "")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := sendCopy([]byte(original), clipboard.FormatText); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: could not restore the clipboard: %v\n", err)
+			}
+		}()
+
+		payload := make([]byte, benchSize)
+		durations := make([]time.Duration, 0, benchCount)
+		for i := 0; i < benchCount; i++ {
+			rand.Read(payload)
+			if benchSize > 0 {
+				// A trailing NUL would be stripped as a text terminator and fail the comparison
+				payload[benchSize-1] |= 1
+			}
+			start := time.Now()
+			if err := sendCopy(payload, clipboard.FormatText); err != nil {
+				return err
+			}
+			got, err := doHTTPSRequest("GET", serverURL(util.RequestPaste), "")
+			if err != nil {
+				return err
+			}
+			durations = append(durations, time.Since(start))
+
+			if !bytes.Equal([]byte(got), payload) {
+				return withExitCode(ExitServer, fmt.Errorf("round trip %d returned different content than was copied", i+1))
+			}
+		}
+
+		result := summarizeBench(durations)
+		if benchJSON {
+			return json.NewEncoder(os.Stdout).Encode(result)
+		}
+		fmt.Printf("%d round trips of %d bytes: min %.2fms, max %.2fms, mean %.2fms, p95 %.2fms\n",
+			result.Count, result.Size, result.MinMs, result.MaxMs, result.MeanMs, result.P95Ms)
+		return nil
+	},
+}
+
+// summarizeBench computes the latency statistics of the measured round trips.
+func summarizeBench(durations []time.Duration) benchResult {
+	slices.Sort(durations)
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	// Nearest-rank percentile
+	p95 := durations[(len(durations)*95+99)/100-1]
+	return benchResult{
+		Count:  len(durations),
+		Size:   benchSize,
+		MinMs:  ms(durations[0]),
+		MaxMs:  ms(durations[len(durations)-1]),
+		MeanMs: ms(total / time.Duration(len(durations))),
+		P95Ms:  ms(p95),
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+	benchCmd.Flags().IntVar(&benchCount, "count", 20, "number of copy and paste round trips to measure")
+	benchCmd.Flags().IntVar(&benchSize, "size", 64, "bytes of random data copied in each round trip")
+	benchCmd.Flags().BoolVar(&benchJSON, "json", false, "print the results as JSON")
+}
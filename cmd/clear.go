@@ -0,0 +1,24 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"pb/util"
+)
+
+var clearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Empties the server's clipboard",
+	Long:  fmt.Sprintf(`Empties the remote %s server's clipboard, e.g. after copying a password, rather than overwriting it with other content.`, util.ProgramName),
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := doHTTPSRequest("POST", serverURL(util.RequestClear), "")
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(clearCmd)
+	clearCmd.Flags().StringVar(&namespace, "namespace", "", "team namespace on the server; its registers are kept apart from other namespaces")
+	clearCmd.Flags().StringVar(&register, "register", "", fmt.Sprintf("register to clear (%q selects the shared clipboard on a --per-key-clipboard server)", util.RegisterShared))
+}
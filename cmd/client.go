@@ -2,117 +2,492 @@ package commands
 
 import (
 	"bytes"
+	"compress/gzip"
 	"crypto/rand"
-	"crypto/sha256"
 	"crypto/tls"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"golang.org/x/crypto/ssh"
+	"hash"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"pb/clipboard"
 	"pb/util"
+	"strconv"
+	"strings"
 )
 
+// serverCapabilities caches the capabilities each server advertised, keyed by host, for this session.
+var serverCapabilities = map[string][]string{}
+
+// register and namespace select the server-side register copy and paste operate on, set by --register and --namespace.
+var (
+	register  string
+	namespace string
+)
+
+// backend forces the server to use this clipboard backend for one operation, set by --backend.
+var backend string
+
+// defaultSSHKeys are the ~/.ssh keys tried after the program-specific key, in priority order.
+var defaultSSHKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa", "id_ed25519_sk", "id_ecdsa_sk"}
+
 // findPrivateKey automatically detects a private key file based on a specific priority.
 func findPrivateKey() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
-	}
+	path, _, err := selectPrivateKey()
+	return path, err
+}
 
+// selectPrivateKey is findPrivateKey that also explains which priority rule picked the key.
+func selectPrivateKey() (string, string, error) {
 	// Priority 1: program-specific key
-	programKeyPath := filepath.Join(home, ".config", util.ProgramName, "id_ed25519")
+	programKeyPath, err := util.ConfigPath("id_ed25519")
+	if err != nil {
+		return "", "", err
+	}
 	if _, err := os.Stat(programKeyPath); err == nil {
-		return programKeyPath, nil
+		return programKeyPath, fmt.Sprintf("%s-specific key in the config directory, which takes priority over ~/.ssh keys", util.ProgramName), nil
 	}
 
 	// Priority 2: Standard SSH keys
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", err
+	}
 	sshDir := filepath.Join(home, ".ssh")
-	defaultKeys := []string{"id_ed25519", "id_ecdsa", "id_rsa"}
-	for _, keyFile := range defaultKeys {
+	for i, keyFile := range defaultSSHKeys {
 		path := filepath.Join(sshDir, keyFile)
 		if _, err := os.Stat(path); err == nil {
-			return path, nil
+			reason := fmt.Sprintf("no %s-specific key at %s", util.ProgramName, programKeyPath)
+			if i > 0 {
+				reason += fmt.Sprintf(", and no %s in %s", strings.Join(defaultSSHKeys[:i], " or "), sshDir)
+			}
+			return path, reason, nil
 		}
 	}
 
 	// Priority 3: Fail with a helpful message
-	return "", fmt.Errorf("no private key found. Please run '%s key-gen' to create a new key, or specify one with the --key flag", util.ProgramName)
+	return "", "", withExitCode(ExitAuth, fmt.Errorf("no private key found. Please run '%s key-gen' to create a new key, or specify one with the --key flag", util.ProgramName))
+}
+
+// generateFirstKey creates the program-specific key on first use and tells the user how to authorize it.
+func generateFirstKey() (string, error) {
+	keyDir, err := util.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	if err := util.GenerateSSHKeys(keyDir); err != nil {
+		return "", fmt.Errorf("failed to generate keys: %w", err)
+	}
+
+	keyPath := filepath.Join(keyDir, "id_ed25519")
+	pubKey, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		return "", fmt.Errorf("could not read generated public key: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "No private key found, generated a new ed25519 key pair in %s/\n", keyDir)
+	fmt.Fprintln(os.Stderr, "Authorize it on the server by running:")
+	fmt.Fprintf(os.Stderr, "  %s key-add \"%s\"\n", util.ProgramName, strings.TrimSpace(string(pubKey)))
+	return keyPath, nil
 }
 
 // getSigner finds and parses a private key, returning an ssh.Signer.
-// It respects the --key flag and the prioritized search path.
+// It respects --fingerprint, then the --key flag, then a key found authorized by discovery, which tries
+// the ssh-agent keys before the key files, then the prioritized search path, then the first key in
+// ssh-agent. A key file whose key ssh-agent holds is signed with through the agent.
 func getSigner() (ssh.Signer, error) {
+	if agentFingerprint != "" {
+		return agentSignerByFingerprint(agentFingerprint)
+	}
+
 	// If --key flag was not used, find a key automatically.
 	var pathToKey string
 	if keyPath != "" {
 		pathToKey = keyPath
+	} else if discovered := discoverKey(); discovered != "" {
+		if fingerprint, ok := strings.CutPrefix(discovered, agentKeyPrefix); ok {
+			return agentSignerByFingerprint(fingerprint)
+		}
+		pathToKey = discovered
 	} else {
 		var err error
 		pathToKey, err = findPrivateKey()
 		if err != nil {
-			return nil, err
+			// Keys kept only in ssh-agent are used when there are none on disk
+			if signers := loadAgentSigners(); len(signers) > 0 {
+				return signers[0], nil
+			}
+			if !autoKeygen {
+				return nil, err
+			}
+			if pathToKey, err = generateFirstKey(); err != nil {
+				return nil, err
+			}
 		}
 	}
 
+	if signer := agentSignerForFile(pathToKey); signer != nil {
+		return signer, nil
+	}
+
 	privateKeyBytes, err := os.ReadFile(pathToKey)
 	if err != nil {
-		return nil, fmt.Errorf("could not read private key at %s: %w", pathToKey, err)
+		return nil, withExitCode(ExitAuth, fmt.Errorf("could not read private key at %s: %w", pathToKey, err))
 	}
 
-	signer, err := ssh.ParsePrivateKey(privateKeyBytes)
+	signer, err := parsePrivateKey(pathToKey, privateKeyBytes)
 	if err != nil {
-		return nil, fmt.Errorf("could not parse private key: %w", err)
+		return nil, withExitCode(ExitAuth, fmt.Errorf("could not parse private key: %w", err))
 	}
 	return signer, nil
 }
 
+// initLocalClipboard prepares this machine's clipboard for when the server is unreachable.
+// The clipboard package tries the system clipboard, then CLI tools, then an in-memory clipboard;
+// that last resort would vanish with this process, so here it counts as no clipboard at all.
+func initLocalClipboard() error {
+	if err := clipboard.Init(); err != nil {
+		return err
+	}
+	if clipboard.IsUsingFallback() {
+		return errNoLocalClipboard
+	}
+	return nil
+}
+
+// errNoLocalClipboard means neither the system clipboard nor a clipboard tool is usable locally.
+var errNoLocalClipboard = errors.New("no system clipboard or clipboard tools (xsel, xclip, wl-clipboard) available")
+
+// serverURL builds the URL of an endpoint on the configured server. IPv6 addresses are bracketed,
+// whether or not they were given with brackets, and a zone such as %eth0 is escaped.
+func serverURL(path string) string {
+	scheme := "https"
+	if noTLS {
+		scheme = "http"
+	}
+	u := url.URL{Scheme: scheme, Host: serverHostPort(), Path: path}
+	return u.String()
+}
+
+// serverHostPort returns the configured server as host:port, with IPv6 addresses bracketed.
+func serverHostPort() string {
+	host := strings.TrimSuffix(strings.TrimPrefix(serverAddress, "["), "]")
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
 // doHTTPSRequest handles the client-side logic for creating and sending a signed HTTPS request.
 func doHTTPSRequest(method, url, data string) (string, error) {
-	signer, err := getSigner()
+	return doSignedRequest(method, url, []byte(data), nil)
+}
+
+// doCompressedRequest sends data of at least util.GzipThreshold bytes gzip-compressed when the server
+// has advertised support for it, and uncompressed otherwise or when compression doesn't shrink it.
+// Data covered by a --signature-file was signed as is, so it is never compressed.
+func doCompressedRequest(method, url string, data []byte, header http.Header) (string, error) {
+	if len(data) < util.GzipThreshold || signatureFile != "" || !serverSupports(url, util.CapabilityGzip) {
+		return doSignedRequest(method, url, data, header)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return "", fmt.Errorf("could not compress payload: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("could not compress payload: %w", err)
+	}
+	if buf.Len() >= len(data) {
+		return doSignedRequest(method, url, data, header)
+	}
+
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Encoding", "gzip")
+	return doSignedRequest(method, url, buf.Bytes(), header)
+}
+
+// serverSupports reports whether the server behind requestURL advertises the given capability.
+// The capabilities are probed once via the version endpoint and cached for the session.
+func serverSupports(requestURL, capability string) bool {
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return false
+	}
+
+	if _, ok := serverCapabilities[u.Host]; !ok {
+		versionURL := url.URL{Scheme: u.Scheme, Host: u.Host, Path: util.RequestVersion}
+		// Older servers don't know the endpoint; the failure simply leaves no capabilities cached.
+		_, _ = doSignedRequest("GET", versionURL.String(), nil, nil)
+		if _, ok := serverCapabilities[u.Host]; !ok {
+			serverCapabilities[u.Host] = nil
+		}
+	}
+
+	for _, c := range serverCapabilities[u.Host] {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// doSignedRequest signs data with the client key, sends it with any extra headers and returns the whole response body.
+func doSignedRequest(method, requestURL string, data []byte, header http.Header) (string, error) {
+	resp, err := sendSignedRequest(method, requestURL, data, header)
 	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
 
-	payloadHash := sha256.Sum256([]byte(data))
-	signature, err := signer.Sign(rand.Reader, payloadHash[:])
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("could not sign payload: %w", err)
+		return "", err
 	}
+	return string(body), nil
+}
 
-	// This client is insecure and trusts any server certificate.
-	// This is acceptable because we are authenticating the server via our SSH key model.
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// sendSignedRequest signs data with the client key and sends it with any extra headers.
+// The signature covers the bytes exactly as sent, so compressed bodies are signed compressed.
+// On success the caller owns the response and must close its body, which allows streaming it.
+// With --signature-file the signature is read from that file instead of being made here, and
+// with --client-cert the TLS handshake authenticates the request so it isn't signed at all.
+func sendSignedRequest(method, requestURL string, data []byte, header http.Header) (*http.Response, error) {
+	var signatureHeader http.Header
+	var err error
+	if signatureFile != "" {
+		signatureHeader, err = readSignatureFile(signatureFile)
+	} else if clientCert == "" {
+		signatureHeader, err = signPayload(data)
+	}
+	if err != nil {
+		return nil, err
 	}
-	client := &http.Client{Transport: tr}
 
-	req, err := http.NewRequest(method, url, bytes.NewBufferString(data))
+	req, err := http.NewRequest(method, requestURL, bytes.NewReader(data))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	req.Header.Set(util.HeaderFingerprint, ssh.FingerprintSHA256(signer.PublicKey()))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	setRegisterHeaders(req)
+	for k, v := range signatureHeader {
+		req.Header[k] = v
+	}
+
+	resp, err := sendRequest(req)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.code == http.StatusUnauthorized {
+		if signatureFile != "" {
+			return nil, withExitCode(ExitAuth, fmt.Errorf("signature in %s was rejected, it must be made by an authorized key over exactly the data sent (%s)", signatureFile, strings.TrimSpace(statusErr.body)))
+		}
+		forgetActiveKey()
+	}
+	return resp, err
+}
+
+// signPayload signs data with the client key, returning the headers that carry the signature.
+func signPayload(data []byte) (http.Header, error) {
+	signer, err := getSigner()
+	if err != nil {
+		return nil, err
+	}
+	return signWith(signer, data)
+}
+
+// signWith signs data with signer, returning the headers that carry the signature.
+func signWith(signer ssh.Signer, data []byte) (http.Header, error) {
+	payloadHash, err := util.SignatureDigest(signatureHash, data)
+	if err != nil {
+		return nil, withExitCode(ExitInvalidInput, err)
+	}
+	signature, err := signer.Sign(rand.Reader, payloadHash)
+	if err != nil {
+		return nil, fmt.Errorf("could not sign payload: %w", err)
+	}
+
+	header := http.Header{}
+	if signatureHash != util.DefaultSignatureHash {
+		header.Set(util.HeaderSignatureHash, signatureHash)
+	}
+	header.Set(util.HeaderFingerprint, ssh.FingerprintSHA256(signer.PublicKey()))
 	// Marshal the entire signature object, not just the blob
 	signatureBytes := ssh.Marshal(signature)
-	req.Header.Set(util.HeaderSignature, base64.StdEncoding.EncodeToString(signatureBytes))
+	header.Set(util.HeaderSignature, base64.StdEncoding.EncodeToString(signatureBytes))
+	return header, nil
+}
 
-	resp, err := client.Do(req)
+// sendStreamedRequest sends body as it is read instead of buffering it, using chunked encoding.
+// The signature covers the same digest of the body bytes as sendSignedRequest, but it can only be
+// computed once the body ends, so it travels in a trailer. Only servers advertising
+// CapabilityTrailerSignature accept it.
+func sendStreamedRequest(method, requestURL string, body io.Reader) (*http.Response, error) {
+	if clientCert != "" {
+		req, err := http.NewRequest(method, requestURL, body)
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = -1
+		setRegisterHeaders(req)
+		return sendRequest(req)
+	}
+
+	signer, err := getSigner()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	payloadHash, err := util.NewSignatureHash(signatureHash)
 	if err != nil {
-		return "", err
+		return nil, withExitCode(ExitInvalidInput, err)
+	}
+
+	trailer := http.Header{http.CanonicalHeaderKey(util.HeaderSignature): nil}
+	req, err := http.NewRequest(method, requestURL, &signingReader{r: body, hash: payloadHash, signer: signer, trailer: trailer})
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = -1
+	req.Trailer = trailer
+
+	setRegisterHeaders(req)
+	setSignatureHashHeader(req)
+	req.Header.Set(util.HeaderFingerprint, ssh.FingerprintSHA256(signer.PublicKey()))
+	return sendRequest(req)
+}
+
+// signingReader hashes everything read through it and, at EOF, stores the signature of the hash in trailer.
+type signingReader struct {
+	r       io.Reader
+	hash    hash.Hash
+	signer  ssh.Signer
+	trailer http.Header
+}
+
+func (s *signingReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.hash.Write(p[:n])
+	if err == io.EOF {
+		signature, signErr := s.signer.Sign(rand.Reader, s.hash.Sum(nil))
+		if signErr != nil {
+			return n, fmt.Errorf("could not sign payload: %w", signErr)
+		}
+		s.trailer.Set(util.HeaderSignature, base64.StdEncoding.EncodeToString(ssh.Marshal(signature)))
+	}
+	return n, err
+}
+
+// setSignatureHashHeader names the --signature-hash the body was digested with. The default is left
+// implicit so servers predating hash negotiation keep accepting requests.
+func setSignatureHashHeader(req *http.Request) {
+	if signatureHash != util.DefaultSignatureHash {
+		req.Header.Set(util.HeaderSignatureHash, signatureHash)
+	}
+}
+
+// setRegisterHeaders adds the --register, --namespace and --backend selection to a request.
+func setRegisterHeaders(req *http.Request) {
+	if backend != "" {
+		req.Header.Set(util.HeaderBackend, backend)
+	}
+	if register != "" {
+		req.Header.Set(util.HeaderRegister, register)
+	}
+	if namespace != "" {
+		req.Header.Set(util.HeaderNamespace, namespace)
+	}
+}
+
+// sendRequest sends a signed request, records the capabilities the server advertises and turns
+// non-200 responses into errors. On success the caller must close the response body.
+func sendRequest(req *http.Request) (*http.Response, error) {
+	resp, err := newHTTPClient().Do(req)
+	if err != nil {
+		return nil, classifyTransportError(req.URL.String(), err)
+	}
+
+	if caps := resp.Header.Get(util.HeaderCapabilities); caps != "" {
+		serverCapabilities[req.URL.Host] = strings.Split(caps, ",")
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("server returned non-200 status: %d\n%s", resp.StatusCode, string(body))
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newStatusError(resp.StatusCode, string(body))
 	}
 
-	return string(body), nil
+	if resp.Header.Get(util.HeaderEncryption) == util.EncryptionPassphrase {
+		return decryptResponse(resp)
+	}
+	return resp, nil
+}
+
+// newHTTPClient returns the client requests to the server are sent with.
+func newHTTPClient() *http.Client {
+	// The self-signed server certificate can't be verified against a CA, so it is pinned instead:
+	// trusted on first use and required to match from then on, unless --insecure is given.
+	// The transport advertises Accept-Encoding: gzip and transparently inflates compressed responses.
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	if !insecure {
+		tr.TLSClientConfig.VerifyPeerCertificate = verifyPinnedCert
+	}
+	if clientCert != "" {
+		tr.TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+			if err != nil {
+				return nil, &clientCertError{err: err}
+			}
+			return &cert, nil
+		}
+	}
+	return &http.Client{
+		Transport: tr,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return errRedirect
+		},
+	}
+}
+
+// encryptPayload seals data with --passphrase, returning the header announcing it.
+func encryptPayload(data []byte) ([]byte, http.Header, error) {
+	sealed, err := util.EncryptWithPassphrase(passphrase, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{}
+	header.Set(util.HeaderEncryption, util.EncryptionPassphrase)
+	return sealed, header, nil
+}
+
+// decryptResponse replaces a passphrase-encrypted response body with its plaintext.
+func decryptResponse(resp *http.Response) (*http.Response, error) {
+	defer resp.Body.Close()
+	if passphrase == "" {
+		return nil, withExitCode(ExitAuth, fmt.Errorf("server content is encrypted with a passphrase, set --passphrase or %s", util.EnvVarPassphrase))
+	}
+
+	sealed, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := util.DecryptWithPassphrase(passphrase, sealed)
+	if err != nil {
+		return nil, withExitCode(ExitAuth, err)
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(plaintext))
+	resp.ContentLength = int64(len(plaintext))
+	resp.Header.Del(util.HeaderEncryption)
+	return resp, nil
 }
@@ -0,0 +1,135 @@
+package commands
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"pb/util"
+	"slices"
+	"strings"
+)
+
+// errRedirect is returned instead of following a redirect: the protocol has none, and following one
+// could hand the signed request to another host.
+var errRedirect = errors.New("refusing to follow redirect from server")
+
+// connectionError means the server could not be reached at all.
+type connectionError struct {
+	url string
+	err error
+}
+
+func (e *connectionError) Error() string {
+	return fmt.Sprintf("server unreachable at %s, is it running? (%v)", e.url, e.err)
+}
+
+func (e *connectionError) Unwrap() error {
+	return e.err
+}
+
+// tlsError means the server was reached but the TLS handshake failed.
+type tlsError struct {
+	err error
+}
+
+func (e *tlsError) Error() string {
+	return fmt.Sprintf("TLS handshake failed, is the server running with --no-tls, or is something else listening on that port? (%v)", e.err)
+}
+
+func (e *tlsError) Unwrap() error {
+	return e.err
+}
+
+// clientCertError means --client-cert or --client-key could not be loaded.
+type clientCertError struct {
+	err error
+}
+
+func (e *clientCertError) Error() string {
+	return fmt.Sprintf("could not load --client-cert: %v", e.err)
+}
+
+func (e *clientCertError) Unwrap() error {
+	return e.err
+}
+
+// clientCertAlerts are the alerts a server started with --client-ca ends the handshake with
+// when the client presents no certificate or one it doesn't trust.
+var clientCertAlerts = []string{
+	"tls: certificate required",
+	"tls: bad certificate",
+	"tls: unknown certificate authority",
+	"tls: expired certificate",
+	"tls: revoked certificate",
+}
+
+// statusError means the server answered with a non-200 status.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	body := strings.TrimSpace(e.body)
+	if e.code == http.StatusUnauthorized {
+		return fmt.Sprintf("key not authorized, run '%s key-print' here and '%s key-add' on the server (%d: %s)", util.ProgramName, util.ProgramName, e.code, body)
+	}
+	return fmt.Sprintf("server returned non-200 status: %d\n%s", e.code, body)
+}
+
+// isUnreachable reports whether err means the server could not be reached, as opposed to
+// the server answering with an error, so callers know when to fall back to the local clipboard.
+func isUnreachable(err error) bool {
+	var connErr *connectionError
+	return errors.As(err, &connErr)
+}
+
+// classifyTransportError wraps an error from http.Client.Do as a refused redirect, TLS or connection error.
+func classifyTransportError(url string, err error) error {
+	if errors.Is(err, errRedirect) {
+		return withExitCode(ExitServer, err)
+	}
+
+	var certErr *clientCertError
+	if errors.As(err, &certErr) {
+		return withExitCode(ExitInvalidInput, certErr)
+	}
+	// A mismatched pin must never look like an unreachable server, which falls back to the local clipboard
+	var pinErr *certPinError
+	if errors.As(err, &pinErr) {
+		return withExitCode(ExitAuth, pinErr)
+	}
+	if strings.Contains(err.Error(), "remote error: ") && slices.ContainsFunc(clientCertAlerts, func(alert string) bool {
+		return strings.Contains(err.Error(), alert)
+	}) {
+		return withExitCode(ExitAuth, fmt.Errorf("server requires a client certificate signed by its --client-ca, pass one with --client-cert and --client-key (%w)", err))
+	}
+
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var verifyErr *tls.CertificateVerificationError
+	if errors.As(err, &recordErr) || errors.As(err, &alertErr) || errors.As(err, &verifyErr) || strings.Contains(err.Error(), "tls: ") {
+		return withExitCode(ExitNetwork, &tlsError{err: err})
+	}
+	return withExitCode(ExitNetwork, &connectionError{url: url, err: err})
+}
+
+// newStatusError builds the error for a non-200 response, tagged with the matching exit code.
+func newStatusError(code int, body string) error {
+	return withExitCode(statusExitCode(code), &statusError{code: code, body: body})
+}
+
+// statusExitCode maps an HTTP error status to an exit code.
+func statusExitCode(status int) int {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ExitAuth
+	case status >= 500:
+		return ExitServer
+	case status >= 400:
+		return ExitInvalidInput
+	default:
+		return ExitFailure
+	}
+}
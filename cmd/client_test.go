@@ -0,0 +1,223 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"pb/server"
+	"pb/util"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestMain runs the tests against an in-process server on a free loopback port, using the in-memory
+// clipboard and a temp config dir whose authorized_keys holds a freshly generated client key.
+// The server and the clipboard package keep global state, so one server serves every test.
+func TestMain(m *testing.M) {
+	os.Exit(runWithTestServer(m))
+}
+
+func runWithTestServer(m *testing.M) int {
+	configDir, err := os.MkdirTemp("", "pb-test-*")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(configDir)
+
+	cancel, err := startTestServer(configDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer cancel()
+	return m.Run()
+}
+
+// startTestServer starts the server in configDir and points the client at it
+func startTestServer(configDir string) (context.CancelFunc, error) {
+	util.SetConfigDir(configDir)
+	// Only the generated key may sign, not one an ssh-agent of whoever runs the tests holds
+	os.Unsetenv("SSH_AUTH_SOCK")
+
+	keyDir := filepath.Join(configDir, "client")
+	if err := util.GenerateSSHKeys(keyDir); err != nil {
+		return nil, err
+	}
+	pubKey, err := os.ReadFile(filepath.Join(keyDir, "id_ed25519.pub"))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "authorized_keys"), pubKey, 0600); err != nil {
+		return nil, err
+	}
+
+	testPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, server.Options{
+			Port:         testPort,
+			Bind:         "127.0.0.1",
+			Fallback:     true,
+			CertValidity: server.DefaultCertValidity,
+		})
+	}()
+
+	serverAddress = "127.0.0.1"
+	port = testPort
+	keyPath = filepath.Join(keyDir, "id_ed25519")
+
+	// Serve generates the certificate before listening, so wait for the port to accept connections
+	for deadline := time.Now().Add(30 * time.Second); ; {
+		select {
+		case err := <-served:
+			cancel()
+			return nil, fmt.Errorf("test server stopped: %w", err)
+		default:
+		}
+		if conn, err := net.Dial("tcp", serverHostPort()); err == nil {
+			conn.Close()
+			return cancel, nil
+		}
+		if time.Now().After(deadline) {
+			cancel()
+			return nil, fmt.Errorf("test server did not start listening on %s", serverHostPort())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// freePort returns a loopback port nothing is listening on
+func freePort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+func TestCopyPaste(t *testing.T) {
+	for _, content := range []string{"hello", "two\nlines\n", ""} {
+		if _, err := doHTTPSRequest("POST", serverURL(util.RequestCopy), content); err != nil {
+			t.Fatalf("copy %q: %v", content, err)
+		}
+		got, err := doHTTPSRequest("GET", serverURL(util.RequestPaste), "")
+		if err != nil {
+			t.Fatalf("paste after copying %q: %v", content, err)
+		}
+		if got != content {
+			t.Errorf("pasted %q, want %q", got, content)
+		}
+	}
+}
+
+func TestUnauthorizedKeyRejected(t *testing.T) {
+	otherDir := t.TempDir()
+	if err := util.GenerateSSHKeys(otherDir); err != nil {
+		t.Fatal(err)
+	}
+	saved := keyPath
+	keyPath = filepath.Join(otherDir, "id_ed25519")
+	defer func() { keyPath = saved }()
+
+	_, err := doHTTPSRequest("GET", serverURL(util.RequestPaste), "")
+	if err == nil {
+		t.Fatal("paste signed with an unauthorized key succeeded")
+	}
+	if code := exitCode(err); code != ExitAuth {
+		t.Errorf("unauthorized key gave exit code %d, want %d (%v)", code, ExitAuth, err)
+	}
+}
+
+func TestRedirectNotFollowed(t *testing.T) {
+	var targetHit atomic.Bool
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		targetHit.Store(true)
+	}))
+	defer target.Close()
+	redirecting := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+r.URL.Path, http.StatusFound)
+	}))
+	defer redirecting.Close()
+
+	// The test servers' certificates aren't the one pinned for the harness server
+	saved := insecure
+	insecure = true
+	defer func() { insecure = saved }()
+
+	_, err := doHTTPSRequest("GET", redirecting.URL+util.RequestPaste, "")
+	if !errors.Is(err, errRedirect) {
+		t.Fatalf("request answered with a 302 returned %v, want %v", err, errRedirect)
+	}
+	if code := exitCode(err); code != ExitServer {
+		t.Errorf("refused redirect gave exit code %d, want %d", code, ExitServer)
+	}
+	if targetHit.Load() {
+		t.Error("the redirect target was requested")
+	}
+}
+
+func TestPasteReportsExpiry(t *testing.T) {
+	header := http.Header{util.HeaderTTL: {"90s"}}
+	if _, err := doSignedRequest("POST", serverURL(util.RequestCopy), []byte("secret"), header); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := sendSignedRequest("GET", serverURL(util.RequestPaste), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if seconds, err := strconv.Atoi(resp.Header.Get(util.HeaderExpiresIn)); err != nil || seconds < 89 || seconds > 90 {
+		t.Errorf("%s = %q after copying with a 90s TTL", util.HeaderExpiresIn, resp.Header.Get(util.HeaderExpiresIn))
+	}
+
+	// Replacing the content cancels the expiry, so there is nothing left to report
+	if _, err := doHTTPSRequest("POST", serverURL(util.RequestCopy), "kept"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = sendSignedRequest("GET", serverURL(util.RequestPaste), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if value := resp.Header.Get(util.HeaderExpiresIn); value != "" {
+		t.Errorf("%s = %q after a copy without TTL, want none", util.HeaderExpiresIn, value)
+	}
+}
+
+func TestStatusWatchView(t *testing.T) {
+	if _, err := doHTTPSRequest("POST", serverURL(util.RequestCopy), "12345"); err != nil {
+		t.Fatal(err)
+	}
+	status, err := fetchStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := fetchSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var view strings.Builder
+	if err := printStatus(&view, status, size); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"memory", "Size:", " 5 bytes\n"} {
+		if !strings.Contains(view.String(), want) {
+			t.Errorf("status view lacks %q:\n%s", want, view.String())
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"pb/util"
+	"strconv"
+	"strings"
+)
+
+// configFile holds defaults for the global flags, one `name = value` per line, read from the
+// config dir unless --config names another file.
+const configFile = "config.toml"
+
+var configFilePath string
+
+// configSetting is one `name = value` line of the config file.
+// Parsed settings hold the value itself, settings to write hold it as written in the file, quoted if a string.
+type configSetting struct {
+	line  int
+	name  string
+	value string
+}
+
+// configFileInUse returns the config file commands read: --config if given, else the one in the config dir.
+func configFileInUse() (string, error) {
+	if configFilePath != "" {
+		return configFilePath, nil
+	}
+	return util.ConfigPath(configFile)
+}
+
+// applyConfigFile gives each global flag not set on the command line its value from the config file.
+// Environment variables are applied afterwards, so they still win over the file. A missing default
+// file is fine, but a missing --config file is an error.
+func applyConfigFile(cmd *cobra.Command) error {
+	path, err := configFileInUse()
+	if err != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if configFilePath == "" && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+
+	settings, err := parseConfig(data)
+	if err != nil {
+		return fmt.Errorf("%s %w", path, err)
+	}
+	for _, s := range settings {
+		// The server saved with `pb use` is not a flag, the root command applies it
+		if s.name == useSetting {
+			continue
+		}
+		// The file is found through these two, so it can't set them
+		flag := cmd.Root().PersistentFlags().Lookup(s.name)
+		if flag == nil || s.name == "config" || s.name == "config-dir" {
+			return fmt.Errorf("%s line %d: unknown setting %q, expected a global flag such as server, port or key", path, s.line, s.name)
+		}
+		if cmd.Flags().Changed(s.name) {
+			continue
+		}
+		// Setting the value directly leaves the flag unchanged, so env vars can still override it
+		if err := flag.Value.Set(s.value); err != nil {
+			return fmt.Errorf("%s line %d: invalid %s: %w", path, s.line, s.name, err)
+		}
+	}
+	return nil
+}
+
+// parseConfig reads the flat subset of TOML the config file uses: `name = value` lines, where the
+// value is a "quoted string", a number or a boolean, blank lines and # comments.
+func parseConfig(data []byte) ([]configSetting, error) {
+	var settings []configSetting
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: tables are not supported, settings go at the top level", i+1)
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected name = value", i+1)
+		}
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+
+		var rest string
+		if strings.HasPrefix(value, `"`) {
+			quoted, err := strconv.QuotedPrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: unterminated string", i+1)
+			}
+			rest = value[len(quoted):]
+			value, _ = strconv.Unquote(quoted)
+		} else {
+			value, rest, _ = strings.Cut(value, "#")
+			value = strings.TrimSpace(value)
+			rest = ""
+		}
+		if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, fmt.Errorf("line %d: unexpected %q after the value", i+1, rest)
+		}
+		if name == "" || value == "" {
+			return nil, fmt.Errorf("line %d: expected name = value", i+1)
+		}
+		settings = append(settings, configSetting{line: i + 1, name: name, value: value})
+	}
+	return settings, nil
+}
+
+// updateConfigFile writes the given settings into the config file at path, creating it if needed, and
+// removes the settings named in remove. A setting already in the file is replaced where it is and any
+// repeats of it dropped, new ones are appended. Every other line, comments included, is kept as it is.
+func updateConfigFile(path string, set []configSetting, remove []string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+
+	values := make(map[string]string)
+	for _, s := range set {
+		values[s.name] = s.value
+	}
+	for _, name := range remove {
+		values[name] = ""
+	}
+
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	written := make(map[string]bool)
+	kept := lines[:0]
+	for _, line := range lines {
+		name, _, ok := strings.Cut(strings.TrimSpace(line), "=")
+		name = strings.TrimSpace(name)
+		value, managed := values[name]
+		if !ok || strings.HasPrefix(name, "#") || !managed {
+			kept = append(kept, line)
+			continue
+		}
+		if value != "" && !written[name] {
+			kept = append(kept, name+" = "+value)
+			written[name] = true
+		}
+	}
+	for _, s := range set {
+		if !written[s.name] {
+			kept = append(kept, s.name+" = "+s.value)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("could not create config directory: %w", err)
+	}
+	if err := util.WriteFileAtomic(path, []byte(strings.Join(kept, "\n")+"\n"), 0600); err != nil {
+		return fmt.Errorf("could not write config file: %w", err)
+	}
+	return nil
+}
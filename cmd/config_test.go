@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pb", configFile)
+
+	// A missing file and its directory are created
+	if err := updateConfigFile(path, []configSetting{{name: "server", value: `"old.example"`}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	original := "# my defaults\nserver = \"older.example\"  # work\nkey = \"~/.ssh/pb\"\nserver = \"old.example\"\n"
+	if err := os.WriteFile(path, []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		set    []configSetting
+		remove []string
+		want   string
+	}{
+		{
+			"replace in place and append",
+			[]configSetting{{name: "server", value: `"clip.example"`}, {name: "port", value: "9000"}},
+			nil,
+			"# my defaults\nserver = \"clip.example\"\nkey = \"~/.ssh/pb\"\nport = 9000\n",
+		},
+		{
+			"remove",
+			nil,
+			[]string{"server", "port"},
+			"# my defaults\nkey = \"~/.ssh/pb\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := updateConfigFile(path, tt.set, tt.remove); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("config file is\n%s\nwant\n%s", data, tt.want)
+			}
+			if _, err := parseConfig(data); err != nil {
+				t.Errorf("updated config file doesn't parse: %v", err)
+			}
+		})
+	}
+}
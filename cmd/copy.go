@@ -1,16 +1,33 @@
 package commands
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/spf13/cobra"
 	"io"
+	"net/http"
 	"os"
+	"os/exec"
+	"os/user"
 	"pb/clipboard"
 	"pb/util"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
 )
 
 var (
-	rosebudFlag bool
+	rosebudFlag  bool
+	mirrorStdout bool
+	forceStdin   bool
+	copyTemplate string
+	trimToMax    bool
+	streamCopy   bool
+	textOnly     bool
+	copyExec     string
+	ifVersion    string
+	copyTTL      time.Duration
 )
 
 const maxClipboardSize = 200 * 1024 * 1024 // 200MB
@@ -18,42 +35,299 @@ const maxClipboardSize = 200 * 1024 * 1024 // 200MB
 var copyCmd = &cobra.Command{
 	Use:   "copy [data to copy]",
 	Short: "Copies data to the server's clipboard",
-	Long:  fmt.Sprintf(`Copies the provided data argument or standard input to the remote %s server's clipboard.`, util.ProgramName),
-	Args:  cobra.MaximumNArgs(1),
+	Long: fmt.Sprintf(`Copies the provided data argument or standard input to the remote %s server's clipboard.
+Standard input is read when no argument is given or when --stdin is set. An empty string argument ("") copies empty content; it does not read standard input.`, util.ProgramName),
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		var dataToCopy []byte
-		if len(args) == 1 {
-			dataToCopy = []byte(args[0])
-		} else {
-			bytes, err := io.ReadAll(os.Stdin)
-			if err != nil {
-				return fmt.Errorf("failed to read from stdin: %w", err)
+		if streamCopy {
+			return copyStream(args)
+		}
+
+		dataToCopy, err := readCopyData(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		if textOnly {
+			if offset := invalidUTF8Offset(dataToCopy); offset >= 0 {
+				return withExitCode(ExitInvalidInput, fmt.Errorf("content is not valid UTF-8 text: invalid byte sequence at offset %d", offset))
 			}
-			dataToCopy = bytes
+		}
+
+		format, err := copyFormat(dataToCopy)
+		if err != nil {
+			return err
 		}
 
 		// Check size limit
+		if len(dataToCopy) > maxClipboardSize && trimToMax {
+			trimmed := trimToSize(dataToCopy, maxClipboardSize)
+			fmt.Fprintf(os.Stderr, "warning: content trimmed to %d bytes, dropped %d bytes\n", len(trimmed), len(dataToCopy)-len(trimmed))
+			dataToCopy = trimmed
+		}
 		if len(dataToCopy) > maxClipboardSize && !rosebudFlag {
-			return fmt.Errorf("data too large: %d bytes (max %d bytes, use --rosebud to bypass)", len(dataToCopy), maxClipboardSize)
+			return withExitCode(ExitInvalidInput, fmt.Errorf("data too large: %d bytes (max %d bytes, use --rosebud to bypass)", len(dataToCopy), maxClipboardSize))
 		}
 
-		url := fmt.Sprintf("https://%s:%d%s", serverAddress, port, util.RequestCopy)
-		_, err := doHTTPSRequest("POST", url, string(dataToCopy))
-		
-		// If server fails, try local clipboard
-		if err != nil {
-			if err := clipboard.Init(); err != nil {
-				return fmt.Errorf("server unreachable and clipboard unavailable: %w", err)
+		// Mirror the raw bytes to stdout, like tee, so pb can sit in the middle of a pipe
+		if mirrorStdout {
+			if _, err := os.Stdout.Write(dataToCopy); err != nil {
+				return fmt.Errorf("failed to mirror data to stdout: %w", err)
+			}
+		}
+
+		err = sendCopy(dataToCopy, format)
+
+		// If the server is unreachable, try local clipboard, unless the copy was conditional on the server's version
+		// or meant to expire, which the local clipboard can't do once we exit
+		if isUnreachable(err) && ifVersion == "" && copyTTL == 0 {
+			if err := initLocalClipboard(); err != nil {
+				return withExitCode(ExitClipboard, fmt.Errorf("server unreachable and clipboard unavailable: %w", err))
 			}
-			if err := clipboard.Copy(dataToCopy); err != nil {
-				return fmt.Errorf("server unreachable and failed to write to local clipboard: %w", err)
+			if err := clipboard.CopyAs(format, dataToCopy); err != nil {
+				return withExitCode(ExitClipboard, fmt.Errorf("server unreachable and failed to write to local clipboard: %w", err))
 			}
+			// A timed-out write lands in the in-memory fallback, which is lost when we exit
+			if clipboard.IsUsingFallback() {
+				return withExitCode(ExitClipboard, fmt.Errorf("server unreachable and local clipboard did not respond"))
+			}
+			return nil
 		}
-		return nil
+		return err
 	},
 }
 
+// sendCopy sends data in format to the server's clipboard, encrypted with --encrypt and --passphrase
+// when set and compressed when the server supports it.
+func sendCopy(data []byte, format string) error {
+	payload, header := data, http.Header{}
+	if encryptKeyFile != "" {
+		if signatureFile != "" {
+			return withExitCode(ExitInvalidInput, fmt.Errorf("--encrypt cannot be combined with --signature-file, the encrypted payload differs from the signed data"))
+		}
+		var err error
+		if payload, err = encryptContent(payload); err != nil {
+			return err
+		}
+		header.Set(util.HeaderOpaque, "true")
+	}
+	if passphrase != "" {
+		if signatureFile != "" {
+			return withExitCode(ExitInvalidInput, fmt.Errorf("--passphrase cannot be combined with --signature-file, the encrypted payload differs from the signed data"))
+		}
+		sealed, sealedHeader, err := encryptPayload(payload)
+		if err != nil {
+			return err
+		}
+		payload = sealed
+		header.Set(util.HeaderEncryption, sealedHeader.Get(util.HeaderEncryption))
+	}
+
+	if ifVersion != "" {
+		header.Set("If-Match", ifVersion)
+	}
+	if copyTTL > 0 {
+		header.Set(util.HeaderTTL, copyTTL.String())
+	}
+	if format == clipboard.FormatImage {
+		header.Set("Content-Type", clipboard.ImageMIMEType)
+	}
+
+	_, err := doCompressedRequest("POST", serverURL(util.RequestCopy), payload, header)
+	return err
+}
+
+// copyStream uploads stdin as it is read, so large inputs are never held in memory here.
+// Unlike a buffered copy it cannot fall back to the local clipboard, since the input is consumed.
+func copyStream(args []string) error {
+	if len(args) == 1 {
+		return withExitCode(ExitInvalidInput, fmt.Errorf("--stream reads stdin and cannot be combined with a data argument"))
+	}
+	if passphrase != "" {
+		return withExitCode(ExitInvalidInput, fmt.Errorf("--stream cannot be combined with --passphrase, which needs the whole content to encrypt it"))
+	}
+	if signatureFile != "" {
+		return withExitCode(ExitInvalidInput, fmt.Errorf("--stream cannot be combined with --signature-file, streamed copies are signed as they are sent"))
+	}
+
+	url := serverURL(util.RequestCopy)
+	if !serverSupports(url, util.CapabilityTrailerSignature) {
+		return withExitCode(ExitServer, fmt.Errorf("server does not support streamed copies, retry without --stream"))
+	}
+
+	var in io.Reader = os.Stdin
+	if mirrorStdout {
+		in = io.TeeReader(in, os.Stdout)
+	}
+	limited := &sizeLimitReader{r: in, remaining: maxClipboardSize}
+	if !rosebudFlag {
+		in = limited
+	}
+
+	resp, err := sendStreamedRequest("POST", url, in)
+	if limited.exceeded {
+		return withExitCode(ExitInvalidInput, fmt.Errorf("data too large: more than %d bytes (use --rosebud to bypass)", maxClipboardSize))
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// sizeLimitReader fails once more than remaining bytes have been read.
+type sizeLimitReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		l.exceeded = true
+		return n, fmt.Errorf("data too large")
+	}
+	return n, err
+}
+
+// readCopyData returns the content to copy from --exec, --template, the argument or stdin.
+func readCopyData(cmd *cobra.Command, args []string) ([]byte, error) {
+	if cmd.Flags().Changed("exec") {
+		if len(args) == 1 {
+			return nil, withExitCode(ExitInvalidInput, fmt.Errorf("--exec cannot be combined with a data argument"))
+		}
+		return runCopyExec(copyExec)
+	}
+
+	if cmd.Flags().Changed("template") {
+		if len(args) == 1 || forceStdin {
+			return nil, withExitCode(ExitInvalidInput, fmt.Errorf("--template cannot be combined with a data argument or --stdin"))
+		}
+		return expandTemplate(copyTemplate)
+	}
+
+	if len(args) == 1 && !forceStdin {
+		return []byte(args[0]), nil
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, withExitCode(ExitInvalidInput, fmt.Errorf("failed to read from stdin: %w", err))
+	}
+	return data, nil
+}
+
+// trimToSize cuts data to at most max bytes. Valid UTF-8 text is cut on a character boundary.
+func trimToSize(data []byte, max int) []byte {
+	if len(data) <= max {
+		return data
+	}
+	if !utf8.Valid(data) {
+		return data[:max]
+	}
+	n := max
+	for n > 0 && !utf8.RuneStart(data[n]) {
+		n--
+	}
+	return data[:n]
+}
+
+// invalidUTF8Offset returns the byte offset of the first invalid UTF-8 sequence in data, or -1 if it is valid.
+func invalidUTF8Offset(data []byte) int {
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i
+		}
+		i += size
+	}
+	return -1
+}
+
+// runCopyExec runs command and returns its stdout. Its stderr is passed through on success
+// and reported with the exit status on failure, in which case nothing is copied.
+func runCopyExec(command string) ([]byte, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, withExitCode(ExitInvalidInput, fmt.Errorf("--exec requires a command"))
+	}
+
+	var stdout, stderr bytes.Buffer
+	c := exec.Command(fields[0], fields[1:]...)
+	c.Stdin = os.Stdin
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("command %q failed, nothing copied: %w\n%s", command, err, msg)
+		}
+		return nil, fmt.Errorf("command %q failed, nothing copied: %w", command, err)
+	}
+
+	os.Stderr.Write(stderr.Bytes())
+	return stdout.Bytes(), nil
+}
+
+// templateVars is the fixed set of variables available to --template.
+type templateVars struct {
+	Hostname string
+	User     string
+	Time     string // RFC 3339
+	Date     string // YYYY-MM-DD
+	Cwd      string
+}
+
+// expandTemplate renders text with the built-in template variables.
+func expandTemplate(text string) ([]byte, error) {
+	tmpl, err := template.New("copy").Parse(text)
+	if err != nil {
+		return nil, withExitCode(ExitInvalidInput, fmt.Errorf("invalid template: %w", err))
+	}
+
+	now := time.Now()
+	vars := templateVars{
+		Time: now.Format(time.RFC3339),
+		Date: now.Format(time.DateOnly),
+	}
+	vars.Hostname, _ = os.Hostname()
+	vars.Cwd, _ = os.Getwd()
+	if u, err := user.Current(); err == nil {
+		vars.User = u.Username
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return nil, withExitCode(ExitInvalidInput, fmt.Errorf("could not expand template: %w", err))
+	}
+	return buf.Bytes(), nil
+}
+
 func init() {
 	rootCmd.AddCommand(copyCmd)
-	copyCmd.Flags().BoolVar(&rosebudFlag, "rosebud", false, "bypass clipboard size limit")
+	copyCmd.Flags().StringVar(&namespace, "namespace", "", "team namespace on the server; its registers are kept apart from other namespaces")
+	copyCmd.Flags().StringVar(&register, "register", "", fmt.Sprintf("register to use on the server (%q selects the shared clipboard on a --per-key-clipboard server)", util.RegisterShared))
+	copyCmd.Flags().StringVar(&backend, "backend", "", fmt.Sprintf("use this clipboard backend (%s, %s or %s) for this operation; needs --allow-backend-override on the server", clipboard.BackendSystem, clipboard.BackendCLI, clipboard.BackendMemory))
+	copyCmd.Flags().StringVar(&contentType, "type", "", fmt.Sprintf("copy the data as %s or %s (default: %s for PNG data, %s otherwise)", clipboard.FormatText, clipboard.FormatImage, clipboard.FormatImage, clipboard.FormatText))
+	copyCmd.Flags().StringVar(&encryptKeyFile, "encrypt", "", "encrypt the content end to end with the secret in this file, so the server only holds ciphertext; paste with the same --encrypt")
+	copyCmd.Flags().BoolVar(&rosebudFlag, "rosebud", false, "bypass the client size limit (the server's --max-size still applies); pair with --stream so large inputs aren't buffered in memory first")
+	copyCmd.Flags().BoolVar(&trimToMax, "trim-to-max", false, "truncate content over the size limit instead of failing, with a warning")
+	copyCmd.Flags().BoolVar(&textOnly, "text-only", false, "reject content that is not valid UTF-8 text")
+	copyCmd.Flags().BoolVar(&streamCopy, "stream", false, "upload stdin while it is read instead of buffering it first (no local fallback if the server is unreachable)")
+	copyCmd.Flags().StringVar(&copyExec, "exec", "", "copy the output of this command, split on whitespace (no shell quoting), aborting if it fails")
+	copyCmd.Flags().StringVar(&copyTemplate, "template", "", "copy this text/template instead of data, with {{.Hostname}}, {{.User}}, {{.Time}}, {{.Date}} and {{.Cwd}} expanded")
+	copyCmd.Flags().BoolVar(&forceStdin, "stdin", false, "always read the data from stdin, ignoring any argument")
+	copyCmd.Flags().BoolVar(&mirrorStdout, "mirror-stdout", false, "also write the copied data to stdout")
+	copyCmd.Flags().BoolVar(&mirrorStdout, "tee", false, "alias for --mirror-stdout")
+	copyCmd.Flags().DurationVar(&copyTTL, "ttl", 0, "have the server clear the clipboard after this long, e.g. 30s for a secret, unless something else is copied first (no local fallback if the server is unreachable)")
+	copyCmd.Flags().StringVar(&ifVersion, "if-version", "", "only copy if the server's clipboard is still at this version, as printed by paste --print-version")
+	copyCmd.MarkFlagsMutuallyExclusive("rosebud", "trim-to-max")
+	copyCmd.MarkFlagsMutuallyExclusive("stream", "template")
+	copyCmd.MarkFlagsMutuallyExclusive("stream", "trim-to-max")
+	copyCmd.MarkFlagsMutuallyExclusive("stream", "text-only")
+	copyCmd.MarkFlagsMutuallyExclusive("stream", "if-version")
+	copyCmd.MarkFlagsMutuallyExclusive("stream", "type")
+	copyCmd.MarkFlagsMutuallyExclusive("stream", "encrypt")
+	copyCmd.MarkFlagsMutuallyExclusive("stream", "ttl")
+	copyCmd.MarkFlagsMutuallyExclusive("exec", "template", "stdin", "stream")
 }
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"pb/util"
+)
+
+// encryptKeyFile names the file holding the secret copy and paste encrypt content with end to end, set by --encrypt.
+// Unlike --passphrase, the server never holds the secret, so it only ever sees ciphertext.
+var encryptKeyFile string
+
+// readEncryptKey returns the secret in encryptKeyFile, without a trailing newline.
+func readEncryptKey() (string, error) {
+	data, err := os.ReadFile(encryptKeyFile)
+	if err != nil {
+		return "", withExitCode(ExitInvalidInput, fmt.Errorf("could not read --encrypt key: %w", err))
+	}
+	key := string(bytes.TrimRight(data, "\r\n"))
+	if key == "" {
+		return "", withExitCode(ExitInvalidInput, fmt.Errorf("--encrypt key file %s is empty", encryptKeyFile))
+	}
+	return key, nil
+}
+
+// encryptContent seals data with the --encrypt secret before it leaves this machine.
+func encryptContent(data []byte) ([]byte, error) {
+	key, err := readEncryptKey()
+	if err != nil {
+		return nil, err
+	}
+	return util.EncryptWithPassphrase(key, data)
+}
+
+// decryptContent opens content sealed by encryptContent.
+func decryptContent(data []byte) ([]byte, error) {
+	key, err := readEncryptKey()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := util.DecryptWithPassphrase(key, data)
+	if errors.Is(err, util.ErrWrongPassphrase) {
+		return nil, withExitCode(ExitAuth, fmt.Errorf("could not decrypt clipboard content with the --encrypt key, was it copied with the same key?"))
+	}
+	return plaintext, err
+}
@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"errors"
+)
+
+// Exit codes returned by Execute so scripts can tell failure modes apart.
+const (
+	ExitFailure      = 1 // unclassified failure
+	ExitInvalidInput = 2 // bad flags, arguments or input data
+	ExitAuth         = 3 // no usable key, or the server rejected the key
+	ExitNetwork      = 4 // server unreachable
+	ExitClipboard    = 5 // no clipboard available, locally or on the server
+	ExitServer       = 6 // the server failed to handle the request
+)
+
+const exitCodesHelp = `Exit codes:
+  0  success
+  1  unclassified failure
+  2  invalid input (flags, arguments or data)
+  3  authentication failure (no usable key, or key not authorized)
+  4  network failure (server unreachable)
+  5  clipboard unavailable
+  6  server error`
+
+// exitError carries the exit code Execute should use for an error.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode tags err with an exit code. Errors that already carry one keep it.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	var existing *exitError
+	if errors.As(err, &existing) {
+		return err
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode returns the exit code for err, defaulting to ExitFailure.
+func exitCode(err error) int {
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return ExitFailure
+}
@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"fmt"
+	"pb/clipboard"
+)
+
+// contentType is the kind of content copy and paste work with, set by --type. Empty means text
+// for paste, and for copy an image when the data is a PNG and text otherwise.
+var contentType string
+
+// checkContentType rejects a --type other than text or image.
+func checkContentType() error {
+	switch contentType {
+	case "", clipboard.FormatText, clipboard.FormatImage:
+		return nil
+	default:
+		return withExitCode(ExitInvalidInput, fmt.Errorf("invalid --type %q (expected %s or %s)", contentType, clipboard.FormatText, clipboard.FormatImage))
+	}
+}
+
+// copyFormat returns the clipboard format to copy data as. Content encrypted with --encrypt
+// is always sent as text, since the server only sees ciphertext.
+func copyFormat(data []byte) (string, error) {
+	if err := checkContentType(); err != nil {
+		return "", err
+	}
+	if encryptKeyFile != "" {
+		if contentType == clipboard.FormatImage {
+			return "", withExitCode(ExitInvalidInput, fmt.Errorf("--encrypt cannot be combined with --type %s", clipboard.FormatImage))
+		}
+		return clipboard.FormatText, nil
+	}
+	switch contentType {
+	case clipboard.FormatImage:
+		if !clipboard.IsPNG(data) {
+			return "", withExitCode(ExitInvalidInput, fmt.Errorf("--type %s needs PNG data", clipboard.FormatImage))
+		}
+		return clipboard.FormatImage, nil
+	case clipboard.FormatText:
+		return clipboard.FormatText, nil
+	default:
+		if clipboard.IsPNG(data) {
+			return clipboard.FormatImage, nil
+		}
+		return clipboard.FormatText, nil
+	}
+}
+
+// pasteFormat returns the clipboard format to paste.
+func pasteFormat() (string, error) {
+	if err := checkContentType(); err != nil {
+		return "", err
+	}
+	if encryptKeyFile != "" && contentType == clipboard.FormatImage {
+		return "", withExitCode(ExitInvalidInput, fmt.Errorf("--encrypt cannot be combined with --type %s", clipboard.FormatImage))
+	}
+	if contentType == "" {
+		return clipboard.FormatText, nil
+	}
+	return contentType, nil
+}
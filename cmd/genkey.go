@@ -11,10 +11,12 @@ import (
 var genkeyCmd = &cobra.Command{
 	Use:   "key-gen",
 	Short: fmt.Sprintf("Generates a new %s-specific SSH key", util.ProgramName),
-	Long:  fmt.Sprintf(`Generates a new ed25519 SSH key pair specifically for %s in ~/.config/%s/`, util.ProgramName, util.ProgramName),
+	Long:  fmt.Sprintf(`Generates a new ed25519 SSH key pair specifically for %s in the config directory (~/.config/%s/ by default)`, util.ProgramName, util.ProgramName),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		home, _ := os.UserHomeDir()
-		keyDir := filepath.Join(home, ".config", util.ProgramName)
+		keyDir, err := util.ConfigDir()
+		if err != nil {
+			return err
+		}
 		keyPath := filepath.Join(keyDir, "id_ed25519")
 
 		if _, err := os.Stat(keyPath); err == nil {
@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"pb/util"
+)
+
+var getCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Prints the value stored under a key on the server",
+	Long:  fmt.Sprintf(`Prints the value stored with 'set' in the remote %s server's register named key. Fails if nothing was stored under it.`, util.ProgramName),
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateKey(args[0]); err != nil {
+			return withExitCode(ExitInvalidInput, err)
+		}
+
+		register = args[0]
+		value, err := doHTTPSRequest("GET", serverURL(util.RequestPaste), "")
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.WriteString(value)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+	getCmd.Flags().StringVar(&namespace, "namespace", "", "team namespace on the server; its registers are kept apart from other namespaces")
+}
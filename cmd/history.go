@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"pb/util"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+var historyLimit int
+
+var historyCmd = &cobra.Command{
+	Use:   "history [index]",
+	Short: "Lists or restores recent copies to the server's clipboard",
+	Long: fmt.Sprintf(`Lists the recent copies the remote %s server remembers, newest first. Given an index from that list,
+copies that entry back into the server's clipboard instead. With --register, lists or restores that register's
+own history instead of the clipboard's.`, util.ProgramName),
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			index, err := strconv.Atoi(args[0])
+			if err != nil || index < 0 {
+				return withExitCode(ExitInvalidInput, fmt.Errorf("invalid history index %q", args[0]))
+			}
+			_, err = doHTTPSRequest("POST", serverURL(util.RequestHistory), strconv.Itoa(index))
+			return err
+		}
+
+		body, err := doHTTPSRequest("GET", serverURL(util.RequestHistory), "")
+		if err != nil {
+			return err
+		}
+
+		var history struct {
+			Entries []struct {
+				Index   int       `json:"index"`
+				Time    time.Time `json:"time"`
+				Format  string    `json:"format"`
+				Size    int       `json:"size"`
+				Preview string    `json:"preview"`
+			} `json:"entries"`
+		}
+		if err := json.Unmarshal([]byte(body), &history); err != nil {
+			return withExitCode(ExitServer, fmt.Errorf("invalid history response from server: %w", err))
+		}
+
+		entries := history.Entries
+		if historyLimit > 0 && len(entries) > historyLimit {
+			entries = entries[:historyLimit]
+		}
+		if len(entries) == 0 {
+			if register != "" {
+				fmt.Printf("No history for register %q\n", register)
+			} else {
+				fmt.Println("No clipboard history")
+			}
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "INDEX\tCOPIED\tSIZE\tCONTENT")
+		for _, entry := range entries {
+			fmt.Fprintf(w, "%d\t%s ago\t%d\t%s\n", entry.Index, time.Since(entry.Time).Round(time.Second), entry.Size, entry.Preview)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().IntVar(&historyLimit, "limit", 0, "list at most this many entries, newest first (0 lists all)")
+	historyCmd.Flags().StringVar(&register, "register", "", fmt.Sprintf("list or restore this register's history (%q selects the shared clipboard on a --per-key-clipboard server)", util.RegisterShared))
+}
@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"path/filepath"
+	"pb/util"
+)
+
+var (
+	importSymlink bool
+	importForce   bool
+)
+
+var importKeyCmd = &cobra.Command{
+	Use:   "key-import <private key path>",
+	Short: fmt.Sprintf("Uses an existing SSH key as the %s-specific key", util.ProgramName),
+	Long:  fmt.Sprintf(`Copies (or symlinks with --symlink) an existing SSH private key into the config directory (~/.config/%s/ by default) as the %s-specific key, which is preferred over keys in ~/.ssh.`, util.ProgramName, util.ProgramName),
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		srcPath, err := filepath.Abs(args[0])
+		if err != nil {
+			return err
+		}
+
+		keyBytes, err := os.ReadFile(srcPath)
+		if err != nil {
+			return withExitCode(ExitInvalidInput, fmt.Errorf("could not read private key: %w", err))
+		}
+		signer, err := parsePrivateKey(srcPath, keyBytes)
+		if err != nil {
+			return withExitCode(ExitInvalidInput, fmt.Errorf("invalid private key: %w", err))
+		}
+
+		keyDir, err := util.ConfigDir()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(keyDir, 0700); err != nil {
+			return fmt.Errorf("could not create config directory: %w", err)
+		}
+
+		keyPath := filepath.Join(keyDir, "id_ed25519")
+		if _, err := os.Lstat(keyPath); err == nil {
+			if !importForce {
+				return fmt.Errorf("%s key already exists at %s (use --force to replace it)", util.ProgramName, keyPath)
+			}
+			if err := os.Remove(keyPath); err != nil {
+				return fmt.Errorf("could not replace existing key: %w", err)
+			}
+		}
+
+		if importSymlink {
+			err = os.Symlink(srcPath, keyPath)
+		} else {
+			err = os.WriteFile(keyPath, keyBytes, 0600)
+		}
+		if err != nil {
+			return fmt.Errorf("could not import private key: %w", err)
+		}
+
+		// Derive the public key so the key pair in the config directory is complete
+		pubKeyBytes := ssh.MarshalAuthorizedKey(signer.PublicKey())
+		if err := os.WriteFile(keyPath+".pub", pubKeyBytes, 0644); err != nil {
+			return fmt.Errorf("unable to save public key: %w", err)
+		}
+
+		fmt.Printf("Imported %s as %s\n", srcPath, keyPath)
+		fmt.Println("You can now add this key to a server's authorized_keys file by running:")
+		fmt.Printf("  %s key-add \"$(cat %s.pub)\" --server <server_address>\n", util.ProgramName, keyPath)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importKeyCmd)
+	importKeyCmd.Flags().BoolVar(&importSymlink, "symlink", false, "symlink the key instead of copying it")
+	importKeyCmd.Flags().BoolVar(&importForce, "force", false, fmt.Sprintf("replace an existing %s-specific key", util.ProgramName))
+}
@@ -0,0 +1,212 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"golang.org/x/crypto/ssh"
+	"net/http"
+	"os"
+	"path/filepath"
+	"pb/util"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// activeKeyFile, in the config directory, caches the key discovery found authorized by each server, one
+// `host:port key` line per server. The key is a path, or agentKeyPrefix and the fingerprint of a key
+// only ssh-agent holds.
+const activeKeyFile = "active-key"
+
+// keyDiscoveryTimeout bounds how long discovery waits for the server to answer the probes.
+const keyDiscoveryTimeout = 5 * time.Second
+
+var (
+	discoveryOnce sync.Once
+	discoveredKey string
+)
+
+// discoverKey returns the key to sign with when there are several candidates and no --key: the cached
+// choice from an earlier run, or else the highest priority candidate the server accepts, found by
+// probing with all of them at once. It returns "" when there is nothing to choose between or no
+// candidate was accepted, leaving the prioritized search path to decide.
+func discoverKey() string {
+	discoveryOnce.Do(func() {
+		if cached := readActiveKey(); cached != "" {
+			discoveredKey = cached
+			return
+		}
+
+		paths, signers := candidateSigners()
+		if len(signers) < 2 {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), keyDiscoveryTimeout)
+		defer cancel()
+
+		accepted := make([]bool, len(signers))
+		var wg sync.WaitGroup
+		for i, signer := range signers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				accepted[i] = probeKey(ctx, signer)
+			}()
+		}
+		wg.Wait()
+
+		for i, ok := range accepted {
+			if ok {
+				discoveredKey = paths[i]
+				writeActiveKey(discoveredKey)
+				return
+			}
+		}
+	})
+	return discoveredKey
+}
+
+// candidateSigners returns every key discovery tries, in priority order, with its signer: the keys
+// ssh-agent holds, named agentKeyPrefix and their fingerprint, then the keys the prioritized search
+// path would consider that the agent doesn't hold. Key files that can't be parsed without a passphrase
+// are left out, so discovery never prompts.
+func candidateSigners() ([]string, []ssh.Signer) {
+	var paths []string
+	var signers []ssh.Signer
+	seen := map[string]bool{}
+	for _, signer := range loadAgentSigners() {
+		fingerprint := ssh.FingerprintSHA256(signer.PublicKey())
+		paths = append(paths, agentKeyPrefix+fingerprint)
+		signers = append(signers, signer)
+		seen[fingerprint] = true
+	}
+
+	var candidates []string
+	if programKeyPath, err := util.ConfigPath("id_ed25519"); err == nil {
+		candidates = append(candidates, programKeyPath)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, keyFile := range defaultSSHKeys {
+			candidates = append(candidates, filepath.Join(home, ".ssh", keyFile))
+		}
+	}
+	for _, path := range candidates {
+		data, err := os.ReadFile(path)
+		if err != nil || agentSignerForFile(path) != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil || seen[ssh.FingerprintSHA256(signer.PublicKey())] {
+			continue
+		}
+		paths = append(paths, path)
+		signers = append(signers, signer)
+	}
+	return paths, signers
+}
+
+// probeKey reports whether the server accepts requests signed by signer, asking the read-only version endpoint.
+func probeKey(ctx context.Context, signer ssh.Signer) bool {
+	header, err := signWith(signer, nil)
+	if err != nil {
+		return false
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", serverURL(util.RequestVersion), bytes.NewReader(nil))
+	if err != nil {
+		return false
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := newHTTPClient().Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// readActiveKey returns the key cached for the server, or "" if there is none or the key is gone.
+func readActiveKey() string {
+	path := readActiveKeys()[serverHostPort()]
+	if path == "" {
+		return ""
+	}
+	if fingerprint, ok := strings.CutPrefix(path, agentKeyPrefix); ok {
+		for _, signer := range loadAgentSigners() {
+			if ssh.FingerprintSHA256(signer.PublicKey()) == fingerprint {
+				return path
+			}
+		}
+		return ""
+	}
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// readActiveKeys returns the cached keys by host:port. Lines without a server, as earlier versions
+// wrote, are skipped, so discovery runs again.
+func readActiveKeys() map[string]string {
+	keys := map[string]string{}
+	cachePath, err := util.ConfigPath(activeKeyFile)
+	if err != nil {
+		return keys
+	}
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return keys
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if host, key, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+			keys[host] = strings.TrimSpace(key)
+		}
+	}
+	return keys
+}
+
+// writeActiveKey caches path as the server's key for later runs. Failing to is harmless, discovery just runs again.
+func writeActiveKey(path string) {
+	storeActiveKey(path)
+}
+
+// forgetActiveKey drops the server's cached key after the server rejected it, so the next run discovers again.
+func forgetActiveKey() {
+	if discoveredKey == "" {
+		return
+	}
+	storeActiveKey("")
+}
+
+// storeActiveKey sets the cached key of the server, or drops it if key is "", keeping the other servers' keys.
+func storeActiveKey(key string) {
+	cachePath, err := util.ConfigPath(activeKeyFile)
+	if err != nil {
+		return
+	}
+	keys := readActiveKeys()
+	if key == "" {
+		delete(keys, serverHostPort())
+	} else {
+		keys[serverHostPort()] = key
+	}
+
+	hosts := make([]string, 0, len(keys))
+	for host := range keys {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	var data strings.Builder
+	for _, host := range hosts {
+		data.WriteString(host + " " + keys[host] + "\n")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+		return
+	}
+	util.WriteFileAtomic(cachePath, []byte(data.String()), 0600)
+}
@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"testing"
+)
+
+func TestActiveKeyPerServer(t *testing.T) {
+	useFreshDiscovery(t)
+	savedPort := port
+	t.Cleanup(func() { port = savedPort })
+
+	writeActiveKey(keyPath)
+	port = savedPort + 1
+	if got := readActiveKey(); got != "" {
+		t.Errorf("key cached for another server used: %s", got)
+	}
+	writeActiveKey(keyPath + ".other")
+
+	port = savedPort
+	if got := readActiveKey(); got != keyPath {
+		t.Errorf("cached key is %q, want %q", got, keyPath)
+	}
+	discoveredKey = keyPath
+	forgetActiveKey()
+	if got := readActiveKey(); got != "" {
+		t.Errorf("forgotten key still cached: %s", got)
+	}
+	port = savedPort + 1
+	if got := readActiveKeys()[serverHostPort()]; got != keyPath+".other" {
+		t.Errorf("key cached for the other server is %q after forgetting this one's", got)
+	}
+}
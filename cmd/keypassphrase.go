@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+	"os"
+	"strings"
+)
+
+// keyPassphraseFrom is where to read a protected private key's passphrase instead of prompting for it,
+// set by --key-passphrase-from.
+var keyPassphraseFrom string
+
+// parsePrivateKey parses the private key read from path, asking for its passphrase if it has one.
+// Keys without a passphrase are parsed without prompting.
+func parsePrivateKey(path string, keyBytes []byte) (ssh.Signer, error) {
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return signer, err
+	}
+
+	keyPassphrase, err := readKeyPassphrase(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(keyBytes, keyPassphrase)
+	if errors.Is(err, x509.IncorrectPasswordError) {
+		return nil, fmt.Errorf("wrong passphrase for %s", path)
+	}
+	return signer, err
+}
+
+// readKeyPassphrase returns the passphrase of the key at path from --key-passphrase-from, or asks for it
+// on the terminal without echoing it.
+func readKeyPassphrase(path string) ([]byte, error) {
+	switch source := keyPassphraseFrom; {
+	case strings.HasPrefix(source, "env:"):
+		name := strings.TrimPrefix(source, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("--key-passphrase-from: environment variable %s is not set", name)
+		}
+		return []byte(value), nil
+	case strings.HasPrefix(source, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(source, "file:"))
+		if err != nil {
+			return nil, fmt.Errorf("--key-passphrase-from: %w", err)
+		}
+		return bytes.TrimRight(data, "\r\n"), nil
+	case source != "":
+		return nil, fmt.Errorf("invalid --key-passphrase-from %q: expected env:NAME or file:PATH", source)
+	}
+
+	// Prompt on the terminal itself, so it works while stdin and stdout carry clipboard data
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s is passphrase protected and there is no terminal to ask for it, use --key-passphrase-from", path)
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "Enter passphrase for %s: ", path)
+	keyPassphrase, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	if err != nil {
+		return nil, fmt.Errorf("could not read passphrase: %w", err)
+	}
+	return keyPassphrase, nil
+}
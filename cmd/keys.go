@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"pb/util"
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Lists the keys stored on the server",
+	Long:  fmt.Sprintf(`Lists the keys stored with 'set' on the remote %s server, i.e. the names of its registers, one per line.`, util.ProgramName),
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keys, err := doHTTPSRequest("GET", serverURL(util.RequestRegisters), "")
+		if err != nil {
+			return err
+		}
+		fmt.Print(keys)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(keysCmd)
+	keysCmd.Flags().StringVar(&namespace, "namespace", "", "team namespace on the server; its registers are kept apart from other namespaces")
+}
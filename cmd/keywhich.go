@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"pb/util"
+	"strings"
+)
+
+var keyWhichCmd = &cobra.Command{
+	Use:   "key-which",
+	Short: "Shows which private key will be used for authentication, and why",
+	Long: fmt.Sprintf(`Shows the path and fingerprint of the private key %s signs requests with, and the rule that selected it.
+Keys are chosen in this order: --fingerprint from ssh-agent, --key (or %s), then the first key the server accepts when there are several to choose from, trying the keys in the ssh-agent at SSH_AUTH_SOCK before the key files, then id_ed25519 in the config directory (~/.config/%s/ by default), then ~/.ssh/id_ed25519, ~/.ssh/id_ecdsa, ~/.ssh/id_rsa, ~/.ssh/id_ed25519_sk and ~/.ssh/id_ecdsa_sk, then the first key in ssh-agent.
+A chosen key file whose key ssh-agent holds is signed with through the agent.`, util.ProgramName, util.EnvVarKey, util.ProgramName),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var path, reason string
+		switch {
+		case agentFingerprint != "":
+			if _, err := agentSignerByFingerprint(agentFingerprint); err != nil {
+				return err
+			}
+			printKeyChoice("ssh-agent", agentFingerprint, "set with --fingerprint")
+			return nil
+		case cmd.Flags().Changed("key"):
+			path, reason = keyPath, "set with --key"
+		case keyPath != "":
+			path, reason = keyPath, fmt.Sprintf("set with %s", util.EnvVarKey)
+		case discoverKey() != "":
+			const discovered = "accepted by the server, found by key discovery"
+			if fingerprint, ok := strings.CutPrefix(discoverKey(), agentKeyPrefix); ok {
+				printKeyChoice("ssh-agent", fingerprint, discovered)
+				return nil
+			}
+			path, reason = discoverKey(), discovered
+		default:
+			var err error
+			if path, reason, err = selectPrivateKey(); err != nil {
+				if signers := loadAgentSigners(); len(signers) > 0 {
+					printKeyChoice("ssh-agent", ssh.FingerprintSHA256(signers[0].PublicKey()), "no key on disk, so the first key in ssh-agent")
+					return nil
+				}
+				return err
+			}
+		}
+
+		fingerprint, err := keyFingerprint(path)
+		if err != nil {
+			return err
+		}
+		if agentSignerForFile(path) != nil {
+			reason += ", signed with through ssh-agent"
+		}
+		printKeyChoice(path, fingerprint, reason)
+		return nil
+	},
+}
+
+// printKeyChoice prints the key key-which found, its fingerprint and why it was chosen.
+func printKeyChoice(key, fingerprint, reason string) {
+	fmt.Printf("Key:         %s\n", key)
+	fmt.Printf("Fingerprint: %s\n", fingerprint)
+	fmt.Printf("Reason:      %s\n", reason)
+}
+
+// keyFingerprint returns the SHA256 fingerprint of the private key at path. Keys that can't be
+// parsed, such as passphrase-protected ones, fall back to the public key next to them.
+func keyFingerprint(path string) (string, error) {
+	privateKeyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", withExitCode(ExitAuth, fmt.Errorf("could not read private key at %s: %w", path, err))
+	}
+
+	signer, err := ssh.ParsePrivateKey(privateKeyBytes)
+	if err == nil {
+		return ssh.FingerprintSHA256(signer.PublicKey()), nil
+	}
+
+	if pubKeyBytes, pubErr := os.ReadFile(path + ".pub"); pubErr == nil {
+		if pubKey, _, _, _, pubErr := ssh.ParseAuthorizedKey(pubKeyBytes); pubErr == nil {
+			return ssh.FingerprintSHA256(pubKey), nil
+		}
+	}
+	return "", withExitCode(ExitAuth, fmt.Errorf("could not parse private key: %w", err))
+}
+
+func init() {
+	rootCmd.AddCommand(keyWhichCmd)
+}
@@ -0,0 +1,160 @@
+package commands
+
+import (
+	"bufio"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"pb/util"
+	"strings"
+	"sync"
+)
+
+// knownHostsFile pins the public key fingerprint of the certificate of each server the client has
+// trusted, one `host:port fingerprint` line per server, like ssh's known_hosts. Pinning the key rather
+// than the whole certificate lets the server renew its certificate without clients noticing.
+const knownHostsFile = "known_hosts"
+
+// insecure skips certificate pinning and trusts any server certificate, set by --insecure.
+var insecure bool
+
+var (
+	pinMu       sync.Mutex
+	pinVerified = map[string]string{} // fingerprints already checked in this run, by host:port
+)
+
+// certPinError means the server presented a certificate with a key other than the one pinned for it.
+type certPinError struct {
+	host   string
+	pinned string
+	got    string
+	path   string
+}
+
+func (e *certPinError) Error() string {
+	return fmt.Sprintf("certificate key of %s does not match the pinned one, someone may be impersonating the server.\n"+
+		"Pinned: %s\nGot:    %s\n"+
+		"If the server replaced its certificate key, check the new fingerprint with '%s server cert-fingerprint' on it, "+
+		"then remove the line for %s from %s or run once from a terminal to accept it",
+		e.host, e.pinned, e.got, util.ProgramName, e.host, e.path)
+}
+
+// verifyPinnedCert checks the key of the certificate the server presented against the one pinned for
+// it in knownHostsFile. A server seen for the first time is trusted and pinned; a changed key is only
+// accepted if the user confirms it on the terminal.
+func verifyPinnedCert(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("server presented no certificate")
+	}
+	host := serverHostPort()
+	fingerprint, err := util.PublicKeyFingerprint(rawCerts[0])
+	if err != nil {
+		return fmt.Errorf("could not parse server certificate: %w", err)
+	}
+
+	// Requests may run in parallel, as key discovery does, so only one of them may prompt or write
+	pinMu.Lock()
+	defer pinMu.Unlock()
+	if pinVerified[host] == fingerprint {
+		return nil
+	}
+
+	path, err := util.ConfigPath(knownHostsFile)
+	if err != nil {
+		return err
+	}
+	known, err := readKnownHosts(path)
+	if err != nil {
+		return err
+	}
+
+	switch pinned := known[host]; pinned {
+	case fingerprint:
+	case util.CertFingerprint(rawCerts[0]):
+		// Pinned by an earlier version, which pinned the whole certificate: pin its key from now on
+		if err := pinCert(path, host, fingerprint); err != nil {
+			return err
+		}
+	case "":
+		fmt.Fprintf(os.Stderr, "Trusting %s on first use, certificate key fingerprint %s\n", host, fingerprint)
+		fmt.Fprintf(os.Stderr, "Compare it with '%s server cert-fingerprint' on the server.\n", util.ProgramName)
+		if err := pinCert(path, host, fingerprint); err != nil {
+			return err
+		}
+	default:
+		pinErr := &certPinError{host: host, pinned: pinned, got: fingerprint, path: path}
+		if !confirmChangedCert(pinErr) {
+			return pinErr
+		}
+		if err := pinCert(path, host, fingerprint); err != nil {
+			return err
+		}
+	}
+	pinVerified[host] = fingerprint
+	return nil
+}
+
+// readKnownHosts returns the pinned fingerprints by host:port; a missing file pins nothing.
+func readKnownHosts(path string) (map[string]string, error) {
+	known := map[string]string{}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return known, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && !strings.HasPrefix(fields[0], "#") {
+			known[fields[0]] = fields[1]
+		}
+	}
+	return known, scanner.Err()
+}
+
+// pinCert records fingerprint as the certificate key of host, replacing any earlier pin.
+func pinCert(path, host, fingerprint string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not read %s: %w", path, err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if fields := strings.Fields(line); line != "" && (len(fields) == 0 || fields[0] != host) {
+			lines = append(lines, line)
+		}
+	}
+	lines = append(lines, host+" "+fingerprint)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("could not create config directory: %w", err)
+	}
+	if err := util.WriteFileAtomic(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		return fmt.Errorf("could not pin certificate in %s: %w", path, err)
+	}
+	return nil
+}
+
+// confirmChangedCert asks on the terminal whether to trust the changed certificate key in pinErr.
+// Without a terminal the change is refused.
+func confirmChangedCert(pinErr *certPinError) bool {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "WARNING: the certificate key of %s changed.\nPinned: %s\nGot:    %s\n", pinErr.host, pinErr.pinned, pinErr.got)
+	fmt.Fprintf(tty, "Check it with '%s server cert-fingerprint' on the server. Trust the new key? [y/N] ", util.ProgramName)
+	answer, _ := bufio.NewReader(tty).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"pb/util"
+	"testing"
+	"time"
+)
+
+// testCert returns a self-signed DER certificate for key with the given serial
+func testCert(t *testing.T, key ed25519.PrivateKey, serial int64) []byte {
+	t.Helper()
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestPinnedCertSurvivesRenewal(t *testing.T) {
+	savedServer := serverAddress
+	serverAddress = "renewed.example"
+	t.Cleanup(func() { serverAddress = savedServer })
+	host := serverHostPort()
+	forget := func() {
+		pinMu.Lock()
+		delete(pinVerified, host)
+		pinMu.Unlock()
+	}
+	t.Cleanup(forget)
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, renewed := testCert(t, key, 1), testCert(t, key, 2)
+	path, err := util.ConfigPath(knownHostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A pin of the whole certificate, as earlier versions wrote, moves to the key
+	if err := pinCert(path, host, util.CertFingerprint(original)); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyPinnedCert([][]byte{original}, nil); err != nil {
+		t.Fatalf("certificate pinned by an earlier version rejected: %v", err)
+	}
+	known, err := readKnownHosts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := util.PublicKeyFingerprint(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if known[host] != want {
+		t.Errorf("pinned %s, want the key fingerprint %s", known[host], want)
+	}
+
+	forget()
+	if err := verifyPinnedCert([][]byte{renewed}, nil); err != nil {
+		t.Errorf("renewed certificate with the same key rejected: %v", err)
+	}
+}
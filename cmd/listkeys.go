@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"pb/util"
+	"text/tabwriter"
+)
+
+var keyGroup string
+
+var listKeysCmd = &cobra.Command{
+	Use:   "key-list",
+	Short: "Lists the keys in the server's authorized_keys",
+	Long: fmt.Sprintf(`Lists the keys in the authorized_keys file in the config directory (~/.config/%s/ by default) with their fingerprint, type, group and comment.
+Keys are grouped by a %sNAME tag in their comment, e.g. "laptop %steam-a", which --group filters on.`, util.ProgramName, util.GroupTagPrefix, util.GroupTagPrefix),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		authKeysPath, err := util.ConfigPath("authorized_keys")
+		if err != nil {
+			return err
+		}
+
+		bytes, err := os.ReadFile(authKeysPath)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not read authorized_keys file: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FINGERPRINT\tTYPE\tGROUP\tCOMMENT")
+		for len(bytes) > 0 {
+			pubKey, comment, _, rest, err := ssh.ParseAuthorizedKey(bytes)
+			if err != nil {
+				break
+			}
+			bytes = rest
+
+			group := util.KeyGroup(comment)
+			if keyGroup != "" && group != keyGroup {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", ssh.FingerprintSHA256(pubKey), pubKey.Type(), group, comment)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listKeysCmd)
+	listKeysCmd.Flags().StringVar(&keyGroup, "group", "", "only list keys tagged with this group")
+}
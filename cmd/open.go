@@ -2,24 +2,56 @@ package commands
 
 import (
 	"fmt"
+	"github.com/skratchdot/open-golang/open"
 	"github.com/spf13/cobra"
 	"net/url"
+	"os"
 	"pb/util"
+	"strings"
 )
 
+var openFromClipboard bool
+
 var openCmd = &cobra.Command{
 	Use:   "open [url]",
 	Short: "Opens a URL on the server",
-	Long:  `Sends a URL to the remote %s server to be opened in the default browser.`,
-	Args:  cobra.ExactArgs(1),
+	Long: fmt.Sprintf(`Sends a URL to the remote %s server to be opened in the default browser. With --from-clipboard the URL is taken from the server's clipboard instead.
+If the server is unreachable the URL is opened on this machine, with a warning.`, util.ProgramName),
+	Args: func(cmd *cobra.Command, args []string) error {
+		if openFromClipboard {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		urlToOpen := args[0]
+		var urlToOpen string
+		if openFromClipboard {
+			content, err := doHTTPSRequest("GET", serverURL(util.RequestPaste), "")
+			if err != nil {
+				return err
+			}
+			urlToOpen = strings.TrimSpace(content)
+		} else {
+			urlToOpen = args[0]
+		}
+
 		if _, err := url.ParseRequestURI(urlToOpen); err != nil {
-			return fmt.Errorf("invalid URL provided: %w", err)
+			return withExitCode(ExitInvalidInput, fmt.Errorf("invalid URL provided: %w", err))
 		}
 
-		requestURL := fmt.Sprintf("https://%s:%d%s", serverAddress, port, util.RequestOpen)
+		requestURL := serverURL(util.RequestOpen)
 		_, err := doHTTPSRequest("POST", requestURL, urlToOpen)
+
+		// Like copy and paste, fall back to this machine when the server is unreachable, but not
+		// when it refused the URL, which must not then be opened here instead
+		if isUnreachable(err) {
+			fmt.Fprintf(os.Stderr, "warning: %v; opening the URL locally instead\n", err)
+			if err := open.Run(urlToOpen); err != nil {
+				return withExitCode(ExitFailure, fmt.Errorf("server unreachable and could not open URL locally: %w", err))
+			}
+			fmt.Printf("Opened URL locally: %s\n", urlToOpen)
+			return nil
+		}
 		if err == nil {
 			fmt.Printf("Successfully requested server to open URL: %s\n", urlToOpen)
 		}
@@ -29,4 +61,5 @@ var openCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(openCmd)
+	openCmd.Flags().BoolVar(&openFromClipboard, "from-clipboard", false, "open the URL currently in the server's clipboard")
 }
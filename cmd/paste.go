@@ -1,38 +1,201 @@
 package commands
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
 	"pb/clipboard"
 	"pb/util"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	pasteExec    string
+	maxPasteSize int64
+	pasteDefault string
+	failIfEmpty  bool
+	exitEmpty    int
+	warnDegraded bool
+	printVersion bool
+	showExpiry   bool
 )
 
 var pasteCmd = &cobra.Command{
 	Use:   "paste",
 	Short: "Pastes text from the server's clipboard",
-	Long:  fmt.Sprintf(`Retrieves text from the remote %s server's clipboard and prints it to standard output.`, util.ProgramName),
+	Long: fmt.Sprintf(`Retrieves text from the remote %s server's clipboard and prints it to standard output, or pipes it into a local command with --exec.
+With --type image the clipboard's image is written instead, as PNG.`, util.ProgramName),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		url := fmt.Sprintf("https://%s:%d%s", serverAddress, port, util.RequestPaste)
-		pastedText, err := doHTTPSRequest("GET", url, "")
-		
-		// If server fails, try local clipboard
+		if cmd.Flags().Changed("exit-empty") && (exitEmpty < 1 || exitEmpty > 255) {
+			return withExitCode(ExitInvalidInput, fmt.Errorf("--exit-empty must be between 1 and 255"))
+		}
+
+		format, err := pasteFormat()
 		if err != nil {
-			if err := clipboard.Init(); err != nil {
-				return fmt.Errorf("server unreachable and clipboard unavailable: %w", err)
+			return err
+		}
+
+		var header http.Header
+		if format == clipboard.FormatImage {
+			header = http.Header{"Accept": {clipboard.ImageMIMEType}}
+		}
+
+		url := serverURL(util.RequestPaste)
+		resp, err := sendSignedRequest("GET", url, nil, header)
+
+		// If the server is unreachable, try local clipboard
+		if isUnreachable(err) {
+			if err := initLocalClipboard(); err != nil {
+				return withExitCode(ExitClipboard, fmt.Errorf("server unreachable and clipboard unavailable: %w", err))
 			}
-			data, err := clipboard.Paste()
+			data, err := clipboard.PasteAs(format)
 			if err != nil {
-				return fmt.Errorf("server unreachable and failed to read from local clipboard: %w", err)
+				return withExitCode(ExitClipboard, fmt.Errorf("server unreachable and failed to read from local clipboard: %w", err))
 			}
-			fmt.Print(string(data))
-			return nil
+			if clipboard.IsUsingFallback() {
+				return withExitCode(ExitClipboard, fmt.Errorf("server unreachable and local clipboard did not respond"))
+			}
+			return writePasted(bytes.NewReader(data))
 		}
-		
-		fmt.Print(pastedText)
-		return nil
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if printVersion {
+			fmt.Fprintf(os.Stderr, "version: %s\n", strings.Trim(resp.Header.Get("ETag"), `"`))
+		}
+
+		if warnDegraded && resp.Header.Get(util.HeaderDegraded) == "true" {
+			fmt.Fprintf(os.Stderr, "warning: content served from the server's %s clipboard, not the system clipboard\n", resp.Header.Get(util.HeaderBackend))
+		}
+
+		if showExpiry {
+			if seconds, err := strconv.Atoi(resp.Header.Get(util.HeaderExpiresIn)); err == nil {
+				fmt.Fprintf(os.Stderr, "clipboard expires in %s\n", time.Duration(seconds)*time.Second)
+			}
+		}
+
+		if maxPasteSize > 0 {
+			if size, ok := advertisedSize(resp); ok && size > maxPasteSize {
+				return withExitCode(ExitInvalidInput, fmt.Errorf("clipboard too large: %d bytes (max %d bytes set by --max-paste-size)", size, maxPasteSize))
+			}
+			// Servers that don't advertise a size are cut off once the limit is crossed
+			resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: maxPasteSize}
+		}
+
+		// Content encrypted end to end has to be read whole before it can be decrypted
+		if encryptKeyFile != "" {
+			sealed, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return err
+			}
+			if len(sealed) == 0 {
+				return writePasted(bytes.NewReader(nil))
+			}
+			data, err := decryptContent(sealed)
+			if err != nil {
+				return err
+			}
+			return writePasted(bytes.NewReader(data))
+		}
+
+		// Stream the body so large pastes start appearing immediately and use constant memory
+		return writePasted(resp.Body)
 	},
 }
 
+// advertisedSize returns the clipboard size announced by the server, if any.
+func advertisedSize(resp *http.Response) (int64, bool) {
+	if size, err := strconv.ParseInt(resp.Header.Get(util.HeaderContentSize), 10, 64); err == nil {
+		return size, true
+	}
+	if resp.ContentLength >= 0 {
+		return resp.ContentLength, true
+	}
+	return 0, false
+}
+
+// limitedBody fails reads once more than remaining bytes have been received.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return 0, fmt.Errorf("clipboard exceeds --max-paste-size of %d bytes", maxPasteSize)
+	}
+	return n, err
+}
+
+// writePasted streams the pasted data to stdout, or into the --exec command's stdin.
+// Empty content is replaced by --default or rejected by --fail-if-empty or --exit-empty.
+func writePasted(data io.Reader) error {
+	buffered := bufio.NewReader(data)
+	if _, err := buffered.Peek(1); err == io.EOF {
+		if failIfEmpty {
+			return fmt.Errorf("clipboard is empty")
+		}
+		if exitEmpty != 0 {
+			return withExitCode(exitEmpty, fmt.Errorf("clipboard is empty"))
+		}
+		data = strings.NewReader(pasteDefault)
+	} else {
+		data = buffered
+	}
+
+	if pasteExec == "" {
+		if _, err := io.Copy(os.Stdout, data); err != nil {
+			// The reader went away early, as with `pb paste | head -1`; that's not a failure
+			if errors.Is(err, syscall.EPIPE) {
+				return nil
+			}
+			return fmt.Errorf("failed to write pasted data: %w", err)
+		}
+		return nil
+	}
+
+	fields := strings.Fields(pasteExec)
+	if len(fields) == 0 {
+		return withExitCode(ExitInvalidInput, fmt.Errorf("--exec requires a command"))
+	}
+
+	c := exec.Command(fields[0], fields[1:]...)
+	c.Stdin = data
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("command %q failed: %w", pasteExec, err)
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(pasteCmd)
+	pasteCmd.Flags().StringVar(&namespace, "namespace", "", "team namespace on the server; its registers are kept apart from other namespaces")
+	pasteCmd.Flags().StringVar(&register, "register", "", fmt.Sprintf("register to use on the server (%q selects the shared clipboard on a --per-key-clipboard server)", util.RegisterShared))
+	pasteCmd.Flags().StringVar(&backend, "backend", "", fmt.Sprintf("use this clipboard backend (%s, %s or %s) for this operation; needs --allow-backend-override on the server", clipboard.BackendSystem, clipboard.BackendCLI, clipboard.BackendMemory))
+	pasteCmd.Flags().StringVar(&contentType, "type", "", fmt.Sprintf("paste the clipboard's %s or its %s, as PNG (default %s)", clipboard.FormatText, clipboard.FormatImage, clipboard.FormatText))
+	pasteCmd.Flags().StringVar(&encryptKeyFile, "encrypt", "", "decrypt content copied with --encrypt using the secret in this file")
+	pasteCmd.Flags().Int64Var(&maxPasteSize, "max-paste-size", 0, "refuse to download clipboards larger than this many bytes (0 means no limit)")
+	pasteCmd.Flags().StringVar(&pasteDefault, "default", "", "output this value when the clipboard is empty")
+	pasteCmd.Flags().BoolVar(&failIfEmpty, "fail-if-empty", false, "exit with an error when the clipboard is empty")
+	pasteCmd.Flags().IntVar(&exitEmpty, "exit-empty", 0, "exit with this code when the clipboard is empty, so scripts can branch on it")
+	pasteCmd.MarkFlagsMutuallyExclusive("default", "fail-if-empty", "exit-empty")
+	pasteCmd.Flags().BoolVar(&printVersion, "print-version", false, "print the clipboard's version on stderr, for a later copy --if-version")
+	pasteCmd.Flags().BoolVar(&showExpiry, "show-expiry", false, "tell on stderr how long until the server clears content that was copied with --ttl")
+	pasteCmd.Flags().BoolVar(&warnDegraded, "warn-degraded", false, "warn on stderr when the server's system clipboard is unavailable and content came from its fallback")
+	pasteCmd.Flags().StringVar(&pasteExec, "exec", "", "pipe the pasted content into this local command instead of printing it")
 }
@@ -1,28 +1,73 @@
 package commands
 
 import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/ssh"
 	"pb/util"
+	"strings"
 )
 
+var keyFormat string
+
 var pubkeyCmd = &cobra.Command{
 	Use:   "key-print",
 	Short: "Prints the public key that will be used for authentication",
-	Long:  fmt.Sprintf(`Finds the first available private key (checking ~/.config/%s/id_ed25519 first, then common ~/.ssh keys), derives the public key, and prints it in the authorized_keys format.`, util.ProgramName),
+	Long:  fmt.Sprintf(`Finds the first available private key (checking id_ed25519 in the config directory, ~/.config/%s/ by default, first, then common ~/.ssh keys), derives the public key, and prints it in the authorized_keys format, or the format chosen with --format.`, util.ProgramName),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		signer, err := getSigner()
 		if err != nil {
 			return err
 		}
 
-		pubKeyBytes := ssh.MarshalAuthorizedKey(signer.PublicKey())
-		fmt.Print(string(pubKeyBytes))
+		out, err := formatPublicKey(signer.PublicKey(), keyFormat)
+		if err != nil {
+			return err
+		}
+		fmt.Print(out)
 		return nil
 	},
 }
 
+// formatPublicKey renders a public key as authorized_keys, PEM (PKIX), SHA256 fingerprint or RFC 4716 (ssh2).
+func formatPublicKey(pubKey ssh.PublicKey, format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "authorized", "":
+		return string(ssh.MarshalAuthorizedKey(pubKey)), nil
+	case "fingerprint":
+		return ssh.FingerprintSHA256(pubKey) + "\n", nil
+	case "pem":
+		cryptoKey, ok := pubKey.(ssh.CryptoPublicKey)
+		if !ok {
+			return "", fmt.Errorf("%s keys cannot be converted to PEM", pubKey.Type())
+		}
+		der, err := x509.MarshalPKIXPublicKey(cryptoKey.CryptoPublicKey())
+		if err != nil {
+			return "", fmt.Errorf("could not marshal public key: %w", err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+	case "ssh2":
+		var b strings.Builder
+		b.WriteString("---- BEGIN SSH2 PUBLIC KEY ----\n")
+		fmt.Fprintf(&b, "Comment: \"%s\"\n", pubKey.Type())
+		encoded := base64.StdEncoding.EncodeToString(pubKey.Marshal())
+		// RFC 4716 limits lines to 72 bytes
+		for len(encoded) > 70 {
+			b.WriteString(encoded[:70] + "\n")
+			encoded = encoded[70:]
+		}
+		b.WriteString(encoded + "\n")
+		b.WriteString("---- END SSH2 PUBLIC KEY ----\n")
+		return b.String(), nil
+	default:
+		return "", withExitCode(ExitInvalidInput, fmt.Errorf("unknown key format %q (expected authorized, pem, fingerprint or ssh2)", format))
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(pubkeyCmd)
+	pubkeyCmd.Flags().StringVar(&keyFormat, "format", "authorized", "output format: authorized, pem, fingerprint or ssh2")
 }
@@ -9,14 +9,13 @@ import (
 var quitCmd = &cobra.Command{
 	Use:   "quit",
 	Short: "Quits server",
-	Long:  fmt.Sprintf(`Tell the remote %s server to quit.`, util.ProgramName),
+	Long:  fmt.Sprintf(`Tell the remote %s server to quit. Requests already in progress on it are allowed to finish.`, util.ProgramName),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		url := fmt.Sprintf("https://%s:%d%s", serverAddress, port, util.RequestQuit)
-		_, err := doHTTPSRequest("POST", url, "")
-
-		if err == nil {
+		url := serverURL(util.RequestQuit)
+		if _, err := doHTTPSRequest("POST", url, ""); err != nil {
 			return err
 		}
+		fmt.Println("Server is shutting down")
 		return nil
 	},
 }
@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"pb/util"
+	"strings"
+)
+
+var removeKeyCmd = &cobra.Command{
+	Use:   "key-remove <fingerprint or public key>",
+	Short: "Removes a public key from the server's authorized_keys",
+	Long: fmt.Sprintf(`Removes every entry for a key from the authorized_keys file in the config directory (~/.config/%s/ by default), revoking its access.
+The key is given by its SHA256 fingerprint, as shown by key-list, or as a public key string. The file is left untouched if no entry matches.`, util.ProgramName),
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fingerprint, err := keyFingerprintArg(args[0])
+		if err != nil {
+			return withExitCode(ExitInvalidInput, err)
+		}
+
+		authKeysPath, err := util.ConfigPath("authorized_keys")
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(authKeysPath)
+		if err != nil {
+			return fmt.Errorf("could not read authorized_keys file: %w", err)
+		}
+
+		// Work line by line so comments and lines we can't parse are kept as they are
+		var kept []string
+		removed := 0
+		for _, line := range strings.SplitAfter(string(data), "\n") {
+			if pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line)); err == nil && ssh.FingerprintSHA256(pubKey) == fingerprint {
+				removed++
+				continue
+			}
+			kept = append(kept, line)
+		}
+		if removed == 0 {
+			return withExitCode(ExitInvalidInput, fmt.Errorf("no key with fingerprint %s in %s", fingerprint, authKeysPath))
+		}
+
+		if err := util.WriteFileAtomic(authKeysPath, []byte(strings.Join(kept, "")), 0600); err != nil {
+			return fmt.Errorf("could not rewrite authorized_keys file: %w", err)
+		}
+
+		fmt.Printf("Removed %d entries for %s from %s (a running server accepts the key until it is restarted)\n", removed, fingerprint, authKeysPath)
+		return nil
+	},
+}
+
+// keyFingerprintArg returns the SHA256 fingerprint named by arg, which is either a fingerprint or a public key.
+func keyFingerprintArg(arg string) (string, error) {
+	arg = strings.TrimSpace(arg)
+	if strings.HasPrefix(arg, "SHA256:") {
+		return arg, nil
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(arg))
+	if err != nil {
+		return "", fmt.Errorf("expected a SHA256 fingerprint or a public key: %w", err)
+	}
+	return ssh.FingerprintSHA256(pubKey), nil
+}
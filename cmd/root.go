@@ -8,6 +8,7 @@ import (
 	"pb/clipboard"
 	"pb/util"
 	"strconv"
+	"strings"
 )
 
 var (
@@ -16,20 +17,46 @@ var (
 	port          int
 	keyPath       string
 	enableLogging bool
+	autoKeygen    bool
+	noTLS         bool
+	configDir     string
+	passphrase    string
+	signatureHash string
+	signatureFile string
+	clientCert    string
+	clientKey     string
 )
 
 var rootCmd = &cobra.Command{
 	Use:     util.ProgramName,
 	Version: util.GitHead,
 	Short:   "copies and pastes text between machines.",
-	Long:    `A simple tool for sharing your clipboard over the network, using HTTPS and SSH key authentication.`,
+	Long:    "A simple tool for sharing your clipboard over the network, using HTTPS and SSH key authentication.\n\n" + exitCodesHelp,
 	// This function runs before any subcommand executes.
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if !cmd.Flags().Changed("config-dir") {
+			if envConfigDir := os.Getenv(util.EnvVarConfigDir); envConfigDir != "" {
+				configDir = envConfigDir
+			}
+		}
+		util.SetConfigDir(configDir)
+
+		// The config file only supplies defaults: flags, env vars and the saved server all win over it
+		if err := applyConfigFile(cmd); err != nil {
+			return withExitCode(ExitInvalidInput, err)
+		}
+
 		// Enable logging if --log flag is set
 		if enableLogging {
 			clipboard.EnableLogging()
 		}
 
+		if !cmd.Flags().Changed("passphrase") {
+			if envPassphrase := os.Getenv(util.EnvVarPassphrase); envPassphrase != "" {
+				passphrase = envPassphrase
+			}
+		}
+
 		// This logic only applies to commands that have these flags.
 		// The server command, for example, doesn't have a "server" flag.
 		if cmd.Flags().Lookup("server") != nil {
@@ -50,6 +77,23 @@ var rootCmd = &cobra.Command{
 			}
 		}
 
+		// The server saved with `pb use` wins over the config file's server and port settings, but only for
+		// clients and only when no server was chosen with a flag or env var
+		if cmd != serverCmd && !cmd.Flags().Changed("server") && os.Getenv(util.EnvVarServer) == "" {
+			if path, err := configFileInUse(); err == nil {
+				host, savedPort, err := loadSavedServer(path)
+				if err != nil {
+					return withExitCode(ExitInvalidInput, err)
+				}
+				if host != "" {
+					serverAddress = host
+					if !cmd.Flags().Changed("port") && os.Getenv(util.EnvVarPort) == "" {
+						port = savedPort
+					}
+				}
+			}
+		}
+
 		if cmd.Flags().Lookup("key") != nil {
 			if !cmd.Flags().Changed("key") {
 				if envKey := os.Getenv(util.EnvVarKey); envKey != "" {
@@ -57,17 +101,22 @@ var rootCmd = &cobra.Command{
 				}
 			}
 		}
+		return nil
 	},
 }
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
 func init() {
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return withExitCode(ExitInvalidInput, err)
+	})
+
 	// Hide the default completion command
 	rootCmd.CompletionOptions.HiddenDefaultCmd = true
 
@@ -75,6 +124,21 @@ func init() {
 	// Individual commands can choose which of these to use.
 	rootCmd.PersistentFlags().StringVarP(&serverAddress, "server", "s", "localhost", fmt.Sprintf("Server address (or %s)", util.EnvVarServer))
 	rootCmd.PersistentFlags().IntVarP(&port, "port", "p", util.DefaultPort, fmt.Sprintf("Server port (or %s)", util.EnvVarPort))
-	rootCmd.PersistentFlags().StringVar(&keyPath, "key", "", fmt.Sprintf("Path to private key (or %s)", util.EnvVarKey))
+	rootCmd.PersistentFlags().StringVar(&keyPath, "key", "", fmt.Sprintf("Path to private key (or %s); without it, the ssh-agent keys and then the usual key files are tried against the server", util.EnvVarKey))
+	rootCmd.PersistentFlags().StringVar(&agentFingerprint, "fingerprint", "", "sign with the ssh-agent key with this SHA256 fingerprint, as listed by 'ssh-add -l'")
+	rootCmd.PersistentFlags().BoolVar(&autoKeygen, "auto-keygen", false, fmt.Sprintf("generate a %s-specific key if no private key is found", util.ProgramName))
+	rootCmd.PersistentFlags().StringVar(&configFilePath, "config", "", fmt.Sprintf("read default flag values from this file instead of %s in the config dir; flags and env vars still win over it", configFile))
+	rootCmd.PersistentFlags().StringVar(&configDir, "config-dir", "", fmt.Sprintf("Config directory (or %s, default $XDG_CONFIG_HOME/%s or ~/.config/%s)", util.EnvVarConfigDir, util.ProgramName, util.ProgramName))
+	rootCmd.PersistentFlags().BoolVar(&noTLS, "no-tls", false, "use plain HTTP for trusted networks; requests stay signed but are NOT encrypted")
+	rootCmd.PersistentFlags().BoolVar(&insecure, "insecure", false, fmt.Sprintf("trust any server certificate instead of pinning it in %s on first use", knownHostsFile))
+	rootCmd.PersistentFlags().StringVar(&passphrase, "passphrase", "", fmt.Sprintf("shared passphrase encrypting clipboard content end to end; must match on client and server (or %s)", util.EnvVarPassphrase))
+	rootCmd.PersistentFlags().StringVar(&signatureHash, "signature-hash", util.DefaultSignatureHash, fmt.Sprintf("hash request bodies are digested with before signing: %s (the server must allow it)", strings.Join(util.SignatureHashes(), " or ")))
+	rootCmd.PersistentFlags().StringVar(&keyPassphraseFrom, "key-passphrase-from", "", "read a passphrase-protected key's passphrase from env:NAME or file:PATH instead of asking on the terminal")
+	rootCmd.PersistentFlags().StringVar(&signatureFile, "signature-file", "", "send the signature made in advance by 'sign' from this file instead of signing with a key")
+	rootCmd.PersistentFlags().StringVar(&clientCert, "client-cert", "", "present this PEM certificate to a server started with --client-ca instead of signing requests with a key")
+	rootCmd.PersistentFlags().StringVar(&clientKey, "client-key", "", "private key for --client-cert")
 	rootCmd.PersistentFlags().BoolVar(&enableLogging, "log", false, "enable logging output for debugging.")
+	rootCmd.MarkFlagsRequiredTogether("client-cert", "client-key")
+	rootCmd.MarkFlagsMutuallyExclusive("client-cert", "signature-file")
+	rootCmd.MarkFlagsMutuallyExclusive("key", "fingerprint")
 }
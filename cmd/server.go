@@ -4,13 +4,53 @@ import (
 	"context"
 	"fmt"
 	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"pb/clipboard"
 	"pb/server"
 	"pb/util"
+	"syscall"
+	"time"
 )
 
 var (
-	fallback    bool
-	useCliTool  bool
+	fallback           bool
+	useCliTool         bool
+	managerCompat      bool
+	managerCompatDelay time.Duration
+	replayOnRecovery   bool
+	allowIPs           []string
+	denyIPs            []string
+	perKeyClipboard    bool
+	spillThreshold     int64
+	copyFilter         string
+	pasteFilter        string
+	filterTimeout      time.Duration
+	annotate           bool
+	annotateFormat     string
+	copyRateRequests   float64
+	copyRateBytes      float64
+	certValidity       time.Duration
+	signatureHashes    []string
+	backendOverride    bool
+	maxOpenURLLength   int
+	historySize        int
+	historyMaxBytes    int64
+	historyFile        string
+	historyFileMax     int64
+	bindAddress        string
+	normalizeTrailing  bool
+	clipboardRetries   int
+	retryBackoff       time.Duration
+	backupDir          string
+	clientCA           string
+	clipboardTimeout   time.Duration
+	healthInterval     time.Duration
+	maxSize            int64
+	openSchemes        []string
+	openHosts          []string
+	rateLimit          float64
+	rateBurst          int
 )
 
 var serverCmd = &cobra.Command{
@@ -20,12 +60,118 @@ var serverCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// The 'port' variable is populated by the root command's persistent flag and PersistentPreRun logic.
 
-		return server.Serve(context.Background(), port, "", fallback, useCliTool)
+		// Both default to positive values, so anything else was given explicitly
+		if clipboardTimeout <= 0 || healthInterval <= 0 {
+			return withExitCode(ExitInvalidInput, fmt.Errorf("--clipboard-timeout and --health-interval must be positive"))
+		}
+
+		opts := server.Options{
+			Port:               port,
+			Bind:               bindAddress,
+			Fallback:           fallback,
+			UseCliTool:         useCliTool,
+			NoTLS:              noTLS,
+			ClipboardTimeout:   clipboardTimeout,
+			HealthInterval:     healthInterval,
+			ReplayOnRecovery:   replayOnRecovery,
+			AllowIPs:           allowIPs,
+			DenyIPs:            denyIPs,
+			PerKeyClipboard:    perKeyClipboard,
+			SpillThreshold:     spillThreshold,
+			MaxSize:            maxSize,
+			CopyFilter:         copyFilter,
+			PasteFilter:        pasteFilter,
+			FilterTimeout:      filterTimeout,
+			CopyRequestsPerSec: copyRateRequests,
+			CopyBytesPerSec:    copyRateBytes,
+			RequestsPerSec:     rateLimit,
+			RequestBurst:       rateBurst,
+			CertValidity:       certValidity,
+			Passphrase:         passphrase,
+			SignatureHashes:    signatureHashes,
+			BackendOverride:    backendOverride,
+			MaxOpenURLLength:   maxOpenURLLength,
+			OpenSchemes:        openSchemes,
+			OpenHosts:          openHosts,
+			HistorySize:        historySize,
+			HistoryMaxBytes:    historyMaxBytes,
+			HistoryFile:        historyFile,
+			HistoryFileLimit:   historyFileMax,
+			NormalizeTrailing:  normalizeTrailing,
+			Retries:            clipboardRetries,
+			RetryBackoff:       retryBackoff,
+			BackupDir:          backupDir,
+			ClientCA:           clientCA,
+		}
+		if annotate {
+			opts.AnnotateFormat = annotateFormat
+		}
+		if managerCompat {
+			opts.ManagerCompatDelay = managerCompatDelay
+		}
+		// Stop gracefully on a signal too, so Serve gets to clean up after itself
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return server.Serve(ctx, opts)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(serverCmd)
+	serverCmd.PersistentFlags().StringVar(&bindAddress, "bind", server.DefaultBind, "IP address to listen on, e.g. 127.0.0.1 or a VPN interface's address.")
 	serverCmd.PersistentFlags().BoolVar(&fallback, "fallback", false, "uses the fallback in-memory clipboard implementation.")
 	serverCmd.PersistentFlags().BoolVar(&useCliTool, "use-cli-tool", false, "uses CLI tools for clipboard operations (xsel, xclip, wl-copy/paste, or termux-clipboard-get/set).")
+	serverCmd.PersistentFlags().StringSliceVar(&allowIPs, "allow-ip", nil, "only accept clients from these CIDRs or addresses (default: allow all).")
+	serverCmd.PersistentFlags().StringSliceVar(&denyIPs, "deny-ip", nil, "reject clients from these CIDRs or addresses, even if allowed by --allow-ip.")
+	serverCmd.PersistentFlags().BoolVar(&perKeyClipboard, "per-key-clipboard", false, fmt.Sprintf("give each authorized key its own in-memory clipboard; clients opt into the shared one with --register %s.", util.RegisterShared))
+	serverCmd.PersistentFlags().StringSliceVar(&signatureHashes, "signature-hashes", util.SignatureHashes(), "hashes clients may sign request digests with; restrict this to meet policies such as FIPS.")
+	serverCmd.PersistentFlags().DurationVar(&certValidity, "cert-validity", server.DefaultCertValidity, "how long a newly generated self-signed certificate is valid for; it is regenerated at startup once close to expiring.")
+	serverCmd.PersistentFlags().Float64Var(&rateLimit, "rate-limit", 0, "limit each key to this many requests per second of any kind; excess requests get 429 with Retry-After (0 is unlimited).")
+	serverCmd.PersistentFlags().IntVar(&rateBurst, "burst", 0, "let each key make this many requests back to back before --rate-limit applies (default: the --rate-limit rate).")
+	serverCmd.PersistentFlags().Float64Var(&copyRateRequests, "copy-rate-requests", 0, "limit each key to this many copies per second; excess copies get 429 (0 is unlimited).")
+	serverCmd.PersistentFlags().Float64Var(&copyRateBytes, "copy-rate-bytes", 0, "limit each key to copying this many bytes per second; excess copies get 429 (0 is unlimited).")
+	serverCmd.PersistentFlags().BoolVar(&normalizeTrailing, "normalize-trailing", false, "strip trailing whitespace from each line of copied text; binary content is left untouched.")
+	serverCmd.PersistentFlags().BoolVar(&annotate, "annotate", false, "prepend the copier's key fingerprint and the time to copied text; binary content is left untouched.")
+	serverCmd.PersistentFlags().StringVar(&annotateFormat, "annotate-format", server.DefaultAnnotateFormat, "text/template for the --annotate header, with {{.Fingerprint}} and {{.Time}} expanded.")
+	serverCmd.PersistentFlags().StringVar(&copyFilter, "copy-filter", "", "pipe copied content through this command and store its output; copies are rejected if it fails.")
+	serverCmd.PersistentFlags().StringVar(&pasteFilter, "paste-filter", "", "pipe pasted content through this command and serve its output; pastes are rejected if it fails.")
+	serverCmd.PersistentFlags().DurationVar(&filterTimeout, "filter-timeout", 5*time.Second, "kill a --copy-filter or --paste-filter command that runs longer than this.")
+	serverCmd.PersistentFlags().Int64Var(&maxSize, "max-size", server.DefaultMaxSize, "reject copies and other request bodies larger than this many bytes, compressed or not, with 413 (0 is unlimited).")
+	serverCmd.PersistentFlags().Int64Var(&spillThreshold, "spill-threshold", 0, "keep in-memory clipboard content larger than this many bytes in a temp file instead of RAM (0 disables).")
+	serverCmd.PersistentFlags().IntVar(&maxOpenURLLength, "max-open-url-length", server.DefaultMaxOpenURLLength, "reject open requests for URLs longer than this many bytes (0 is unlimited).")
+	serverCmd.PersistentFlags().StringSliceVar(&openSchemes, "open-schemes", server.DefaultOpenSchemes, "URL schemes open requests may use; others, such as file, are rejected (\"*\" allows any).")
+	serverCmd.PersistentFlags().StringSliceVar(&openHosts, "open-hosts", nil, "only open URLs whose host matches one of these patterns, e.g. *.example.com (default: any host).")
+	serverCmd.PersistentFlags().IntVar(&historySize, "history-size", server.DefaultHistorySize, "remember this many recent copies for the history command, for the clipboard and for each register (0 disables history).")
+	serverCmd.PersistentFlags().Int64Var(&historyMaxBytes, "history-max-bytes", server.DefaultHistoryMaxBytes, "keep at most this many bytes of content in each history, dropping the oldest copies first, whatever --history-size allows; larger copies aren't remembered (0 is unlimited).")
+	serverCmd.PersistentFlags().StringVar(&historyFile, "history-file", "", "keep the history in this JSON file, e.g. ~/.config/pb/history.json, rewritten on every change and reloaded at startup, so it survives restarts.")
+	serverCmd.PersistentFlags().Int64Var(&historyFileMax, "history-file-max-entry", server.DefaultHistoryFileLimit, "leave copies larger than this many bytes out of --history-file; they stay in the history until the server stops (0 is unlimited).")
+	serverCmd.PersistentFlags().StringVar(&backupDir, "backup-dir", "", "let clients write clipboard snapshots with the backup command, into this directory only (default: backups disabled).")
+	serverCmd.PersistentFlags().StringVar(&clientCA, "client-ca", "", "require clients to present a certificate signed by a CA in this PEM file; clients with one skip request signing.")
+	serverCmd.PersistentFlags().BoolVar(&backendOverride, "allow-backend-override", false, "let clients pick the clipboard backend for a single request with --backend, for debugging.")
+	serverCmd.PersistentFlags().DurationVar(&clipboardTimeout, "clipboard-timeout", clipboard.DefaultTimeout, "give up on a system clipboard read or write after this long and switch to the in-memory fallback; raise it for slow X servers.")
+	serverCmd.PersistentFlags().DurationVar(&healthInterval, "health-interval", clipboard.DefaultHealthCheckInterval, "how often to check whether a failed system clipboard has recovered while the fallback is in use.")
+	serverCmd.PersistentFlags().IntVar(&clipboardRetries, "clipboard-retries", 2, "retry a failing system clipboard read or write this many times before switching to the in-memory fallback (0 disables).")
+	serverCmd.PersistentFlags().DurationVar(&retryBackoff, "clipboard-retry-backoff", 50*time.Millisecond, "wait this long before the first --clipboard-retries retry, doubling before each further one.")
+	serverCmd.PersistentFlags().BoolVar(&replayOnRecovery, "replay-on-recovery", false, "copy the last content stored in the fallback into the system clipboard when it recovers.")
+	serverCmd.PersistentFlags().BoolVar(&managerCompat, "manager-compat", false, "read clipboard writes back and retry once if a clipboard manager (CopyQ, GPaste, Klipper, Clipman) altered them.")
+	serverCmd.PersistentFlags().DurationVar(&managerCompatDelay, "manager-compat-delay", 200*time.Millisecond, "how long to wait before reading a write back in --manager-compat mode.")
+}
+
+var certFingerprintCmd = &cobra.Command{
+	Use:   "cert-fingerprint",
+	Short: "Prints the SHA256 fingerprint of the server's TLS certificate key",
+	Long:  `Prints the SHA256 fingerprint of the public key of the server's self-signed TLS certificate, which clients pin. Run it on the server host and compare it, over a channel you trust, with what clients see when they first connect. It stays the same when the certificate is renewed.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fingerprint, err := server.CertFingerprint()
+		if err != nil {
+			return err
+		}
+		fmt.Println(fingerprint)
+		return nil
+	},
+}
+
+func init() {
+	serverCmd.AddCommand(certFingerprintCmd)
 }
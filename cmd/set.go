@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"pb/clipboard"
+	"pb/util"
+	"strings"
+)
+
+var setCmd = &cobra.Command{
+	Use:   "set <key> [value]",
+	Short: "Stores a value under a key on the server",
+	Long:  fmt.Sprintf(`Stores a value in the remote %s server's register named key, using the registers as a small shared key-value store. The value is read from standard input when not given as an argument; read it back with 'get'.`, util.ProgramName),
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateKey(args[0]); err != nil {
+			return withExitCode(ExitInvalidInput, err)
+		}
+
+		var value []byte
+		if len(args) == 2 {
+			value = []byte(args[1])
+		} else {
+			var err error
+			if value, err = io.ReadAll(os.Stdin); err != nil {
+				return withExitCode(ExitInvalidInput, fmt.Errorf("could not read value from stdin: %w", err))
+			}
+		}
+
+		register = args[0]
+		return sendCopy(value, clipboard.FormatText)
+	},
+}
+
+// validateKey rejects keys the server can't use as register names.
+func validateKey(key string) error {
+	if key == "" || key == util.RegisterShared || strings.ContainsAny(key, "/:") {
+		return fmt.Errorf("invalid key %q: must be non-empty, not %q, and must not contain '/' or ':'", key, util.RegisterShared)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(setCmd)
+	setCmd.Flags().StringVar(&namespace, "namespace", "", "team namespace on the server; its registers are kept apart from other namespaces")
+}
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"net/http"
+	"net/textproto"
+	"os"
+	"pb/util"
+)
+
+var signCmd = &cobra.Command{
+	Use:   "sign [file]",
+	Short: "Signs data for sending later with --signature-file",
+	Long: fmt.Sprintf(`Signs the given file, or standard input, with the client key and prints a detached signature.
+Save it and pass it to another %s command with --signature-file, e.g. on a machine without the key:
+
+  %s sign data.txt > data.sig
+  %s copy --signature-file data.sig < data.txt
+
+The signature covers the exact bytes sent, so sign exactly what will be copied; paste and other
+commands without a body need a signature of empty input. Anyone holding it can replay the request.`, util.ProgramName, util.ProgramName, util.ProgramName),
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var data []byte
+		var err error
+		if len(args) == 1 {
+			data, err = os.ReadFile(args[0])
+		} else {
+			data, err = io.ReadAll(os.Stdin)
+		}
+		if err != nil {
+			return withExitCode(ExitInvalidInput, fmt.Errorf("could not read data to sign: %w", err))
+		}
+
+		header, err := signPayload(data)
+		if err != nil {
+			return err
+		}
+		// Make sure the hash is recorded even when it is the default
+		header.Set(util.HeaderSignatureHash, signatureHash)
+		return header.Write(os.Stdout)
+	},
+}
+
+// readSignatureFile reads the signature headers written by the sign command.
+func readSignatureFile(path string) (http.Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, withExitCode(ExitInvalidInput, fmt.Errorf("could not read signature file: %w", err))
+	}
+	defer f.Close()
+
+	mimeHeader, err := textproto.NewReader(bufio.NewReader(f)).ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, withExitCode(ExitInvalidInput, fmt.Errorf("invalid signature file %s: %w", path, err))
+	}
+
+	header := http.Header(mimeHeader)
+	for _, name := range []string{util.HeaderFingerprint, util.HeaderSignature, util.HeaderSignatureHash} {
+		if header.Get(name) == "" {
+			return nil, withExitCode(ExitInvalidInput, fmt.Errorf("invalid signature file %s: missing %s", path, name))
+		}
+	}
+	return header, nil
+}
+
+func init() {
+	rootCmd.AddCommand(signCmd)
+}
@@ -0,0 +1,29 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"pb/util"
+	"strings"
+)
+
+var sizeCmd = &cobra.Command{
+	Use:   "size",
+	Short: "Prints the size of the server's clipboard",
+	Long:  fmt.Sprintf(`Prints the size in bytes of the remote %s server's clipboard without transferring its content, e.g. to check for content or pre-flight a large paste.`, util.ProgramName),
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		size, err := doHTTPSRequest("GET", serverURL(util.RequestSize), "")
+		if err != nil {
+			return err
+		}
+		fmt.Println(strings.TrimSpace(size))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sizeCmd)
+	sizeCmd.Flags().StringVar(&namespace, "namespace", "", "team namespace on the server; its registers are kept apart from other namespaces")
+	sizeCmd.Flags().StringVar(&register, "register", "", fmt.Sprintf("register to use on the server (%q selects the shared clipboard on a --per-key-clipboard server)", util.RegisterShared))
+}
@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"pb/util"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	statusWatch    bool
+	statusInterval time.Duration
+)
+
+// clearScreen moves the cursor home and clears the terminal, so each refresh of status --watch replaces the last
+const clearScreen = "\033[H\033[2J"
+
+// serverStatus is the /status response
+type serverStatus struct {
+	Version       string    `json:"version"`
+	Backend       string    `json:"backend"`
+	UsingFallback bool      `json:"using_fallback"`
+	Started       time.Time `json:"started"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	ExpiresIn     int64     `json:"expires_in_seconds"`
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Reports the server's health and clipboard backend",
+	Long: fmt.Sprintf(`Reports whether the remote %s server is up, its version, how long it has been running and which clipboard backend it uses, including whether it fell back to its in-memory clipboard, and when it clears content copied with --ttl.
+With --watch the report also shows the clipboard's size and is redrawn every --interval in a cleared terminal until interrupted, to keep an eye on a shared server.`, util.ProgramName),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !statusWatch {
+			status, err := fetchStatus()
+			if err != nil {
+				return err
+			}
+			return printStatus(os.Stdout, status, -1)
+		}
+
+		if statusInterval <= 0 {
+			return withExitCode(ExitInvalidInput, fmt.Errorf("--interval must be positive"))
+		}
+		for {
+			// Build the whole view before clearing, so the screen doesn't flicker while the requests are in flight
+			var view strings.Builder
+			status, err := fetchStatus()
+			if err == nil {
+				var size int
+				if size, err = fetchSize(); err == nil {
+					err = printStatus(&view, status, size)
+				}
+			}
+			if err != nil {
+				view.Reset()
+				fmt.Fprintf(&view, "Server: %s\nError: %v\n", serverURL(""), err)
+			}
+			fmt.Fprintf(&view, "\nUpdated %s, every %s. Press Ctrl-C to stop.\n", time.Now().Format(time.TimeOnly), statusInterval)
+			fmt.Print(clearScreen + view.String())
+			time.Sleep(statusInterval)
+		}
+	},
+}
+
+// fetchStatus asks the server for its /status
+func fetchStatus() (serverStatus, error) {
+	var status serverStatus
+	body, err := doHTTPSRequest("GET", serverURL(util.RequestStatus), "")
+	if err != nil {
+		return status, err
+	}
+	if err := json.Unmarshal([]byte(body), &status); err != nil {
+		return status, withExitCode(ExitServer, fmt.Errorf("invalid status response from server: %w", err))
+	}
+	return status, nil
+}
+
+// fetchSize asks the server for the size of its clipboard
+func fetchSize() (int, error) {
+	body, err := doHTTPSRequest("GET", serverURL(util.RequestSize), "")
+	if err != nil {
+		return 0, err
+	}
+	size, err := strconv.Atoi(strings.TrimSpace(body))
+	if err != nil {
+		return 0, withExitCode(ExitServer, fmt.Errorf("invalid size response from server: %q", body))
+	}
+	return size, nil
+}
+
+// printStatus writes the status report to out, with the clipboard's size unless size is negative
+func printStatus(out io.Writer, status serverStatus, size int) error {
+	clipboardState := status.Backend
+	if status.UsingFallback {
+		clipboardState += " (in-memory fallback, not the system clipboard)"
+	}
+	uptime := time.Duration(status.UptimeSeconds) * time.Second
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Server:\t%s\n", serverURL(""))
+	fmt.Fprintf(w, "Version:\t%s\n", status.Version)
+	fmt.Fprintf(w, "Clipboard:\t%s\n", clipboardState)
+	if size >= 0 {
+		fmt.Fprintf(w, "Size:\t%d bytes\n", size)
+	}
+	fmt.Fprintf(w, "Running for:\t%s (started %s)\n", uptime, status.Started.Local().Format(time.RFC3339))
+	if status.ExpiresIn > 0 {
+		fmt.Fprintf(w, "Clears in:\t%s (copied with a TTL)\n", time.Duration(status.ExpiresIn)*time.Second)
+	}
+	return w.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().BoolVar(&statusWatch, "watch", false, "keep redrawing the status, with the clipboard's size, in a cleared terminal until interrupted")
+	statusCmd.Flags().DurationVar(&statusInterval, "interval", 2*time.Second, "how often --watch refreshes the status")
+}
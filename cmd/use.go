@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"net"
+	"os"
+	"pb/util"
+	"strconv"
+	"strings"
+)
+
+// useSetting is the config file setting `pb use` saves the server in, as "host:port". Only clients read
+// it: saving the port as the port setting would also move the port 'pb server' listens on.
+const useSetting = "use"
+
+// legacySavedServerFile, in the config dir, held the server chosen with `pb use` as host:port before
+// it moved to the config file. It is still read until `pb use` saves or clears a server.
+const legacySavedServerFile = "server"
+
+var clearSavedServer bool
+
+var useCmd = &cobra.Command{
+	Use:   "use [server[:port]]",
+	Short: "Sets the server used when --server is not given",
+	Long: fmt.Sprintf(`Saves a server, and optionally a port, as the default for later commands in the %s setting of %s (or the file given with --config). Without an argument it prints the saved server.
+An explicit --server or --port flag still wins, followed by %s and %s, then the saved server, then the server and port settings of the config file. The saved port only applies to clients, not to the port 'server' listens on.`, useSetting, configFile, util.EnvVarServer, util.EnvVarPort),
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := configFileInUse()
+		if err != nil {
+			return err
+		}
+
+		if clearSavedServer {
+			if err := updateConfigFile(path, nil, []string{useSetting}); err != nil {
+				return err
+			}
+			if err := removeLegacySavedServer(); err != nil {
+				return err
+			}
+			fmt.Printf("Cleared the saved server from %s\n", path)
+			return nil
+		}
+
+		if len(args) == 0 {
+			host, savedPort, err := loadSavedServer(path)
+			if err != nil {
+				return withExitCode(ExitInvalidInput, err)
+			}
+			if host == "" {
+				fmt.Printf("No saved server, using %s:%d\n", serverAddress, port)
+				return nil
+			}
+			fmt.Println(net.JoinHostPort(host, strconv.Itoa(savedPort)))
+			return nil
+		}
+
+		host, usePort, err := parseServerArg(args[0], cmd.Flags().Changed("port"))
+		if err != nil {
+			return withExitCode(ExitInvalidInput, err)
+		}
+
+		hostPort := net.JoinHostPort(host, strconv.Itoa(usePort))
+		if err := updateConfigFile(path, []configSetting{{name: useSetting, value: strconv.Quote(hostPort)}}, nil); err != nil {
+			return err
+		}
+		// The config file supersedes the legacy file, which would otherwise come back after a --clear
+		if err := removeLegacySavedServer(); err != nil {
+			return err
+		}
+		fmt.Printf("Now using %s by default (saved in %s)\n", hostPort, path)
+		return nil
+	},
+}
+
+// parseServerArg splits a server[:port] argument. Without a port it uses --port when given, else the default port.
+func parseServerArg(arg string, portFlagSet bool) (string, int, error) {
+	if host, portStr, err := net.SplitHostPort(arg); err == nil {
+		p, err := strconv.Atoi(portStr)
+		if err != nil || p < 1 || p > 65535 {
+			return "", 0, fmt.Errorf("invalid port in %q", arg)
+		}
+		return host, p, nil
+	}
+
+	host := strings.Trim(arg, "[]")
+	if host == "" {
+		return "", 0, fmt.Errorf("server address must not be empty")
+	}
+	if portFlagSet {
+		return host, port, nil
+	}
+	return host, util.DefaultPort, nil
+}
+
+// loadSavedServer returns the server and port saved with `pb use` in the config file at path, or in
+// the legacy saved-server file if the config file has none; an empty host if there is none.
+func loadSavedServer(path string) (string, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", 0, fmt.Errorf("could not read config file: %w", err)
+	}
+	settings, err := parseConfig(data)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s %w", path, err)
+	}
+
+	var saved string
+	for _, s := range settings {
+		if s.name == useSetting {
+			saved = s.value
+		}
+	}
+	if saved == "" {
+		legacyPath, err := util.ConfigPath(legacySavedServerFile)
+		if err != nil {
+			return "", 0, nil
+		}
+		legacy, err := os.ReadFile(legacyPath)
+		if err != nil {
+			return "", 0, nil
+		}
+		saved, path = strings.TrimSpace(string(legacy)), legacyPath
+	}
+
+	host, portStr, err := net.SplitHostPort(saved)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s: invalid saved server %q, expected host:port", path, saved)
+	}
+	savedPort, err := strconv.Atoi(portStr)
+	if err != nil || savedPort < 1 || savedPort > 65535 {
+		return "", 0, fmt.Errorf("%s: invalid port in saved server %q", path, saved)
+	}
+	return host, savedPort, nil
+}
+
+// removeLegacySavedServer deletes the legacy saved-server file, if there is one.
+func removeLegacySavedServer() error {
+	legacyPath, err := util.ConfigPath(legacySavedServerFile)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(legacyPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not remove %s: %w", legacyPath, err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(useCmd)
+	useCmd.Flags().BoolVar(&clearSavedServer, "clear", false, "forget the saved server")
+}
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"pb/util"
+	"testing"
+)
+
+func TestLoadSavedServer(t *testing.T) {
+	legacyPath, err := util.ConfigPath(legacySavedServerFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacyPath, []byte("legacy.example:9000\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(legacyPath) })
+	path := filepath.Join(t.TempDir(), configFile)
+
+	tests := []struct {
+		name     string
+		config   string
+		wantHost string
+		wantPort int
+	}{
+		{"legacy file without a saved server", "port = 2851\n", "legacy.example", 9000},
+		{"config file over the legacy file", "use = \"clip.example:9001\"\nport = 2851\n", "clip.example", 9001},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(tt.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			host, savedPort, err := loadSavedServer(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if host != tt.wantHost || savedPort != tt.wantPort {
+				t.Errorf("saved server is %s:%d, want %s:%d", host, savedPort, tt.wantHost, tt.wantPort)
+			}
+		})
+	}
+}
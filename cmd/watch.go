@@ -0,0 +1,146 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"net/http"
+	"os"
+	"os/exec"
+	"pb/util"
+	"strings"
+	"time"
+)
+
+var (
+	watchExec string
+	watchJSON bool
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Prints the server's clipboard each time it changes",
+	Long: fmt.Sprintf(`Follows the remote %s server's clipboard and prints its content each time it changes, until interrupted.
+With --exec each new value is piped into a command instead, e.g. --exec "tmux load-buffer -" mirrors it into tmux.
+With --json each change is a line of JSON instead, {"timestamp":...,"size":...,"content_base64":...,"backend":...},
+so scripts get metadata along with the content and binary content survives.`, util.ProgramName),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var header http.Header
+		if watchJSON {
+			header = http.Header{util.HeaderWatchFormat: {util.WatchFormatJSON}}
+		}
+		resp, err := sendSignedRequest("GET", serverURL(util.RequestWatch), nil, header)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		// A single event carries the whole clipboard, base64 encoded
+		scanner.Buffer(make([]byte, 64*1024), maxClipboardSize/3*4+1024)
+		var event, data string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if data != "" {
+					if err := handleWatchEvent(event, data); err != nil {
+						return err
+					}
+				}
+				event, data = "", ""
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return withExitCode(ExitNetwork, fmt.Errorf("watch stream interrupted: %w", err))
+		}
+		return withExitCode(ExitServer, fmt.Errorf("server closed the watch stream"))
+	},
+}
+
+// handleWatchEvent decodes one clipboard change from the watch stream and prints it or pipes it into --exec,
+// as a JSON line with --json.
+func handleWatchEvent(event, data string) error {
+	// Servers that don't send structured frames leave the timestamp and backend to the client
+	frame := util.WatchFrame{Timestamp: time.Now()}
+	switch event {
+	case util.EventClipboard:
+		frame.ContentBase64 = data
+	case util.EventClipboardPassphrase:
+		frame.ContentBase64 = data
+		frame.Encryption = util.EncryptionPassphrase
+	case util.EventChange:
+		if err := json.Unmarshal([]byte(data), &frame); err != nil {
+			return withExitCode(ExitServer, fmt.Errorf("invalid event from server: %w", err))
+		}
+	default:
+		// Event types this client doesn't know are skipped, so servers can add more
+		return nil
+	}
+
+	content, err := base64.StdEncoding.DecodeString(frame.ContentBase64)
+	if err != nil {
+		return withExitCode(ExitServer, fmt.Errorf("invalid event from server: %w", err))
+	}
+	switch frame.Encryption {
+	case "":
+	case util.EncryptionPassphrase:
+		if passphrase == "" {
+			return withExitCode(ExitAuth, fmt.Errorf("server content is encrypted with a passphrase, set --passphrase or %s", util.EnvVarPassphrase))
+		}
+		if content, err = util.DecryptWithPassphrase(passphrase, content); err != nil {
+			return withExitCode(ExitAuth, err)
+		}
+	default:
+		return withExitCode(ExitServer, fmt.Errorf("server content is encrypted with unknown scheme %q", frame.Encryption))
+	}
+
+	if watchJSON {
+		if event != util.EventChange {
+			frame.Size = len(content)
+		}
+		frame.ContentBase64 = base64.StdEncoding.EncodeToString(content)
+		frame.Encryption = ""
+		line, err := json.Marshal(frame)
+		if err != nil {
+			return err
+		}
+		content = line
+	}
+
+	if watchExec == "" {
+		if !bytes.HasSuffix(content, []byte("\n")) {
+			content = append(content, '\n')
+		}
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+
+	fields := strings.Fields(watchExec)
+	if len(fields) == 0 {
+		return withExitCode(ExitInvalidInput, fmt.Errorf("--exec requires a command"))
+	}
+	c := exec.Command(fields[0], fields[1:]...)
+	c.Stdin = bytes.NewReader(content)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		// One failed run shouldn't end the watch
+		fmt.Fprintf(os.Stderr, "warning: command %q failed: %v\n", watchExec, err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().StringVar(&watchExec, "exec", "", "pipe each new clipboard value into this command, split on whitespace, instead of printing it")
+	watchCmd.Flags().BoolVar(&watchJSON, "json", false, "print each change as a line of JSON with its timestamp, size, base64 content and the server's clipboard backend")
+}
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"pb/util"
+	"text/tabwriter"
+	"time"
+)
+
+var watchersCmd = &cobra.Command{
+	Use:   "watchers",
+	Short: "Lists the clients watching the server's clipboard",
+	Long:  fmt.Sprintf(`Lists the clients subscribed to the remote %s server's clipboard changes, and whether the server is polling its clipboard for them.`, util.ProgramName),
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body, err := doHTTPSRequest("GET", serverURL(util.RequestWatchers), "")
+		if err != nil {
+			return err
+		}
+
+		var status struct {
+			Count    int  `json:"count"`
+			Polling  bool `json:"polling"`
+			Watchers []struct {
+				Fingerprint string    `json:"fingerprint"`
+				Since       time.Time `json:"since"`
+			} `json:"watchers"`
+		}
+		if err := json.Unmarshal([]byte(body), &status); err != nil {
+			return withExitCode(ExitServer, fmt.Errorf("invalid watchers response from server: %w", err))
+		}
+
+		polling := "idle"
+		if status.Polling {
+			polling = "polling"
+		}
+		fmt.Printf("%d watchers, change detection %s\n", status.Count, polling)
+		if status.Count == 0 {
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FINGERPRINT\tWATCHING FOR")
+		for _, watcher := range status.Watchers {
+			fmt.Fprintf(w, "%s\t%s\n", watcher.Fingerprint, time.Since(watcher.Since).Round(time.Second))
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchersCmd)
+}
@@ -9,6 +9,7 @@ require (
 	github.com/spf13/cobra v1.9.1
 	golang.design/x/clipboard v0.7.1
 	golang.org/x/crypto v0.40.0
+	golang.org/x/term v0.33.0
 )
 
 require (
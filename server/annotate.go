@@ -0,0 +1,48 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultAnnotateFormat is the header --annotate prepends to copied text unless another format is given.
+const DefaultAnnotateFormat = "[copied by {{.Fingerprint}} at {{.Time}}]\n"
+
+// annotation holds the variables available to the annotate format.
+type annotation struct {
+	Fingerprint string
+	Time        string // RFC 3339
+}
+
+// parseAnnotateFormat validates an annotate format when the server starts.
+func parseAnnotateFormat(format string) (*template.Template, error) {
+	tmpl, err := template.New("annotate").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid annotate format: %w", err)
+	}
+	return tmpl, nil
+}
+
+// annotate prepends the header rendered from tmpl to text content. Binary content,
+// anything that isn't valid UTF-8 or contains NUL bytes, is returned untouched.
+func annotate(tmpl *template.Template, data []byte, fingerprint string) ([]byte, error) {
+	if !isText(data) {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	vars := annotation{Fingerprint: fingerprint, Time: time.Now().Format(time.RFC3339)}
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return nil, fmt.Errorf("could not render annotation: %w", err)
+	}
+	buf.Write(data)
+	return buf.Bytes(), nil
+}
+
+// isText reports whether data looks like text rather than binary content.
+func isText(data []byte) bool {
+	return utf8.Valid(data) && bytes.IndexByte(data, 0) < 0
+}
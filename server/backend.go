@@ -0,0 +1,30 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"pb/clipboard"
+	"pb/util"
+)
+
+// requestBackend returns the clipboard backend a request asks for with X-PB-Backend, or "" to use the
+// active one. On error it also returns the status to answer with.
+func requestBackend(r *http.Request, register string) (string, int, error) {
+	backend := r.Header.Get(util.HeaderBackend)
+	if backend == "" {
+		return "", http.StatusOK, nil
+	}
+	if !config.BackendOverride {
+		return "", http.StatusForbidden, fmt.Errorf("backend override is disabled, start the server with --allow-backend-override")
+	}
+	if register != "" {
+		return "", http.StatusBadRequest, fmt.Errorf("backend override only applies to the system clipboard, not registers")
+	}
+	switch backend {
+	case clipboard.BackendSystem, clipboard.BackendCLI, clipboard.BackendMemory:
+		return backend, http.StatusOK, nil
+	default:
+		return "", http.StatusBadRequest, fmt.Errorf("unknown clipboard backend %q (expected %s, %s or %s)",
+			backend, clipboard.BackendSystem, clipboard.BackendCLI, clipboard.BackendMemory)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"pb/clipboard"
+	"pb/util"
+	"strings"
+)
+
+// checkBackupDir makes sure dir is an existing directory and returns its absolute path.
+func checkBackupDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", abs)
+	}
+	return abs, nil
+}
+
+// backupHandler writes the clipboard, or the request's register, to the file named in the request body.
+// The name is relative to the backup directory and is opened through an os.Root, so neither ".."
+// nor symlinks can reach outside it.
+func backupHandler(w http.ResponseWriter, r *http.Request) {
+	if config.BackupDir == "" {
+		http.Error(w, "Backups are disabled on this server, start it with --backup-dir", http.StatusForbidden)
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		readBodyFailed(w, err)
+		return
+	}
+	name := strings.TrimSpace(string(body))
+	if !filepath.IsLocal(name) {
+		http.Error(w, fmt.Sprintf("invalid backup path %q: must be relative and stay inside the backup directory", name), http.StatusBadRequest)
+		return
+	}
+
+	register, err := requestRegister(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if isNamedRegister(r) && !clipboard.HasRegister(register) {
+		http.Error(w, fmt.Sprintf("No register named %q", r.Header.Get(util.HeaderRegister)), http.StatusNotFound)
+		return
+	}
+
+	var content []byte
+	if register != "" {
+		content, err = clipboard.PasteRegister(register)
+	} else {
+		content, err = clipboard.Paste()
+	}
+	if err != nil {
+		http.Error(w, "Failed to read from clipboard", http.StatusInternalServerError)
+		return
+	}
+
+	root, err := os.OpenRoot(config.BackupDir)
+	if err != nil {
+		log.Printf("Failed to open backup directory: %v", err)
+		http.Error(w, "Backup directory unavailable", http.StatusInternalServerError)
+		return
+	}
+	defer root.Close()
+
+	f, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot write backup %q: %v", name, err), http.StatusBadRequest)
+		return
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		log.Printf("Failed to write backup %s: %v", name, err)
+		http.Error(w, "Failed to write backup", http.StatusInternalServerError)
+		return
+	}
+	if err := f.Close(); err != nil {
+		log.Printf("Failed to write backup %s: %v", name, err)
+		http.Error(w, "Failed to write backup", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Backed up %d bytes of clipboard to %s", len(content), name)
+	fmt.Fprintf(w, "Wrote %d bytes to %s\n", len(content), name)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// bufferedBody is a request body authMiddleware already read in full to verify its signature
+type bufferedBody struct {
+	*bytes.Reader
+	data []byte
+}
+
+func (b *bufferedBody) Close() error {
+	return nil
+}
+
+// maxBodyPrealloc caps how much of a claimed Content-Length readBody allocates before the bytes arrive
+const maxBodyPrealloc = 64 * 1024
+
+// readBody returns the whole request body. A body authMiddleware buffered is handed over as is
+// instead of being copied again. authMiddleware reads bodies before their signature is verified,
+// so Content-Length only sizes the initial buffer up to maxBodyPrealloc: a client claiming a huge
+// body and sending nothing must not make the server allocate it. Beyond that the buffer grows with
+// the bytes that actually arrive.
+func readBody(r *http.Request) ([]byte, error) {
+	if b, ok := r.Body.(*bufferedBody); ok {
+		return b.data, nil
+	}
+	var buf bytes.Buffer
+	if r.ContentLength > 0 {
+		buf.Grow(int(min(r.ContentLength, maxBodyPrealloc)))
+	}
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		return nil, err
+	}
+	// net/http stops the body at Content-Length, so one that ends early is the error left to report
+	if r.ContentLength > 0 && int64(buf.Len()) < r.ContentLength {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), nil
+}
+
+// limitBodyMiddleware rejects request bodies over config.MaxSize before authMiddleware buffers them
+func limitBodyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.MaxSize > 0 {
+			if r.ContentLength > config.MaxSize {
+				http.Error(w, fmt.Sprintf("Request body too large (max %d bytes)", config.MaxSize), http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, config.MaxSize)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readBodyFailed answers a request whose body readBody couldn't read, with 413 if it was over config.MaxSize
+func readBodyFailed(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("Request body too large (max %d bytes)", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		want          string
+		wantErr       error
+	}{
+		{"length known", "hello", 5, "hello", nil},
+		{"length unknown", "hello", -1, "hello", nil},
+		{"larger than the preallocation", strings.Repeat("x", 3*maxBodyPrealloc), 3 * maxBodyPrealloc, strings.Repeat("x", 3*maxBodyPrealloc), nil},
+		// A claimed length is never allocated up front, so even an absurd one just ends early
+		{"huge claimed length, nothing sent", "", 1 << 62, "", io.ErrUnexpectedEOF},
+		{"body shorter than claimed", "abc", 200 * 1024 * 1024, "", io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/copy", strings.NewReader(tt.body))
+			r.ContentLength = tt.contentLength
+			got, err := readBody(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("readBody error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != tt.want {
+				t.Errorf("readBody = %d bytes, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestReadBodyTooLarge(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/copy", strings.NewReader("too long"))
+	r.Body = http.MaxBytesReader(w, r.Body, 3)
+	_, err := readBody(r)
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		t.Errorf("readBody over the size limit returned %v, want a MaxBytesError", err)
+	}
+}
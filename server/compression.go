@@ -0,0 +1,92 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"pb/util"
+	"strconv"
+	"strings"
+)
+
+// capabilities lists the optional protocol features this server supports.
+// Clients only use a feature once the server has advertised it, so older peers keep working.
+var capabilities = []string{util.CapabilityGzip, util.CapabilityTrailerSignature}
+
+// capabilitiesMiddleware advertises the server capabilities on every response.
+func capabilitiesMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(util.HeaderCapabilities, strings.Join(capabilities, ","))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decompressMiddleware transparently inflates gzip-encoded request bodies.
+// It must run after authMiddleware, since the signature covers the compressed bytes.
+func decompressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid gzip request body", http.StatusBadRequest)
+			return
+		}
+		defer zr.Close()
+
+		r.Body = io.NopCloser(zr)
+		if config.MaxSize > 0 {
+			// The compressed body was already capped, but it can inflate far beyond that
+			r.Body = http.MaxBytesReader(w, r.Body, config.MaxSize)
+		}
+		r.Header.Del("Content-Encoding")
+		r.ContentLength = -1
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acceptsGzip reports whether the client advertised gzip support for the response.
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if strings.EqualFold(strings.TrimSpace(strings.SplitN(enc, ";", 2)[0]), "gzip") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeBody writes content to the response, compressing it when the client accepts gzip and
+// content is at least util.GzipThreshold bytes.
+func writeBody(w http.ResponseWriter, r *http.Request, content []byte) error {
+	if len(content) < util.GzipThreshold || !acceptsGzip(r) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, err := w.Write(content)
+		return err
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(content); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeBodyFrom is writeBody for content of the given size streamed from body instead of held in memory.
+func writeBodyFrom(w http.ResponseWriter, r *http.Request, body io.Reader, size int64) error {
+	if size < util.GzipThreshold || !acceptsGzip(r) {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		_, err := io.CopyN(w, body, size)
+		return err
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	zw := gzip.NewWriter(w)
+	if _, err := io.CopyN(zw, body, size); err != nil {
+		return err
+	}
+	return zw.Close()
+}
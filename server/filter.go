@@ -0,0 +1,43 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runFilter pipes data through command and returns what it writes to stdout.
+// The command is split on whitespace and killed once config.FilterTimeout elapses.
+func runFilter(command string, data []byte) ([]byte, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty filter command")
+	}
+
+	ctx := context.Background()
+	if config.FilterTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.FilterTimeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("filter %s timed out after %s", fields[0], config.FilterTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("filter %s failed: %w: %s", fields[0], err, msg)
+		}
+		return nil, fmt.Errorf("filter %s failed: %w", fields[0], err)
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"pb/clipboard"
+	"strings"
+)
+
+// copyFormat returns the clipboard format of a copy request's body from its Content-Type. No
+// Content-Type, or any type other than an image, is text as it always was.
+func copyFormat(r *http.Request) (string, error) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return clipboard.FormatText, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid Content-Type %q: %v", contentType, err)
+	}
+	if mediaType == clipboard.ImageMIMEType {
+		return clipboard.FormatImage, nil
+	}
+	if strings.HasPrefix(mediaType, "image/") {
+		return "", fmt.Errorf("unsupported image type %s, only %s can be copied", mediaType, clipboard.ImageMIMEType)
+	}
+	return clipboard.FormatText, nil
+}
+
+// pasteFormat returns the clipboard format a paste request asks for with Accept: an image
+// only when image/png is named explicitly, text otherwise
+func pasteFormat(r *http.Request) string {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted)); err == nil && mediaType == clipboard.ImageMIMEType {
+			return clipboard.FormatImage
+		}
+	}
+	return clipboard.FormatText
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"pb/clipboard"
+	"pb/util"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// historyPreviewLength is how many characters of a text entry's first line /history shows
+const historyPreviewLength = 60
+
+// historyEntry is one entry of the /history response.
+type historyEntry struct {
+	Index   int       `json:"index"`
+	Time    time.Time `json:"time"`
+	Format  string    `json:"format"`
+	Size    int       `json:"size"`
+	Preview string    `json:"preview"`
+}
+
+// historyHandler lists recent copies on GET and restores one into the clipboard on POST. Each register
+// has a history of its own, chosen like the register a copy goes to.
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	if config.HistorySize <= 0 {
+		http.Error(w, "Clipboard history is disabled on this server, start it with --history-size", http.StatusNotFound)
+		return
+	}
+	register, err := requestRegister(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		restoreHistory(w, r, register)
+		return
+	}
+
+	entries := clipboard.History(register)
+	list := make([]historyEntry, len(entries))
+	for i, entry := range entries {
+		list[i] = historyEntry{Index: i, Time: entry.Time, Format: entry.Format, Size: entry.Size, Preview: historyPreview(entry)}
+	}
+
+	body, err := json.Marshal(struct {
+		Entries []historyEntry `json:"entries"`
+	}{Entries: list})
+	if err != nil {
+		http.Error(w, "Failed to encode history", http.StatusInternalServerError)
+		return
+	}
+
+	// Previews are clipboard content, so they get the same protection as pastes
+	if config.Passphrase != "" {
+		if body, err = util.EncryptWithPassphrase(config.Passphrase, body); err != nil {
+			http.Error(w, "Failed to encrypt history", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(util.HeaderEncryption, util.EncryptionPassphrase)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Write(body)
+}
+
+// restoreHistory copies the history entry whose index is the request body back into the register it was copied to.
+func restoreHistory(w http.ResponseWriter, r *http.Request, register string) {
+	body, err := readBody(r)
+	if err != nil {
+		readBodyFailed(w, err)
+		return
+	}
+	index, err := strconv.Atoi(strings.TrimSpace(string(body)))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid history index %q", body), http.StatusBadRequest)
+		return
+	}
+
+	clipboard.LockWrites()
+	defer clipboard.UnlockWrites()
+	err = clipboard.RestoreHistory(register, index)
+	if errors.Is(err, clipboard.ErrNoHistoryEntry) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to write to clipboard", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", versionETag(clipboard.Version(register)))
+	log.Printf("Restored history entry %d", index)
+}
+
+// historyPreview summarises an entry in one line: the start of its first line for text,
+// its kind otherwise.
+func historyPreview(entry clipboard.HistoryEntry) string {
+	if entry.Format == clipboard.FormatImage {
+		return "[image]"
+	}
+	if !isText(entry.Head) {
+		return "[binary]"
+	}
+	line, _, more := strings.Cut(string(entry.Head), "\n")
+	more = more || entry.Size > len(entry.Head)
+	if utf8.RuneCountInString(line) > historyPreviewLength {
+		line, more = string([]rune(line)[:historyPreviewLength]), true
+	}
+	if more {
+		line += "…"
+	}
+	return line
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pb/clipboard"
+	"pb/util"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testHistorySize = 5
+
+var initTestClipboardOnce sync.Once
+
+// initTestClipboard sets the clipboard package up once for the whole test binary, in memory with history
+func initTestClipboard(t *testing.T) {
+	t.Helper()
+	initTestClipboardOnce.Do(func() {
+		if err := clipboard.Init(); err != nil {
+			t.Fatal(err)
+		}
+		clipboard.UseInMemoryClipboard()
+		clipboard.EnableHistory(testHistorySize, 0)
+		config.HistorySize = testHistorySize
+	})
+}
+
+// TestHistoryConcurrentReadsAndCopies lists the history while copies are recorded into it; run with -race
+func TestHistoryConcurrentReadsAndCopies(t *testing.T) {
+	initTestClipboard(t)
+
+	const copiers, copies, readers = 4, 50, 4
+	var wg sync.WaitGroup
+	for c := 0; c < copiers; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < copies; i++ {
+				body := fmt.Sprintf("copier %d copy %d", c, i)
+				w := httptest.NewRecorder()
+				copyHandler(w, httptest.NewRequest(http.MethodPost, "/copy", strings.NewReader(body)))
+				if w.Code != http.StatusOK {
+					t.Errorf("copy %q: %d %s", body, w.Code, w.Body)
+					return
+				}
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	var readersWG sync.WaitGroup
+	for r := 0; r < readers; r++ {
+		readersWG.Add(1)
+		go func() {
+			defer readersWG.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				w := httptest.NewRecorder()
+				historyHandler(w, httptest.NewRequest(http.MethodGet, "/history", nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("history: %d %s", w.Code, w.Body)
+					return
+				}
+				var list struct {
+					Entries []historyEntry `json:"entries"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+					t.Errorf("history response %q: %v", w.Body, err)
+					return
+				}
+				if len(list.Entries) > testHistorySize {
+					t.Errorf("history has %d entries, over its limit of %d", len(list.Entries), testHistorySize)
+				}
+				for i, entry := range list.Entries {
+					// Every entry must be one whole copy, previewed from its own content
+					if entry.Index != i || entry.Size != len(entry.Preview) || !strings.HasPrefix(entry.Preview, "copier ") {
+						t.Errorf("inconsistent history entry %d: %+v", i, entry)
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(done)
+	readersWG.Wait()
+
+	if entries := clipboard.History(""); len(entries) != testHistorySize {
+		t.Errorf("history has %d entries after %d copies, want %d", len(entries), copiers*copies, testHistorySize)
+	}
+}
+
+// TestHistoryPerRegister checks that copies to a register neither enter nor evict the clipboard's history
+func TestHistoryPerRegister(t *testing.T) {
+	initTestClipboard(t)
+
+	post := func(path, register, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if register != "" {
+			r.Header.Set(util.HeaderRegister, register)
+		}
+		w := httptest.NewRecorder()
+		switch path {
+		case "/copy":
+			copyHandler(w, r)
+		default:
+			historyHandler(w, r)
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %q to register %q: %d %s", path, body, register, w.Code, w.Body)
+		}
+		return w
+	}
+
+	post("/copy", "", "kept in the clipboard history")
+	for i := 0; i < 2*testHistorySize; i++ {
+		post("/copy", "noisy", fmt.Sprintf("noisy copy %d", i))
+	}
+
+	if entries := clipboard.History(""); len(entries) == 0 || string(entries[0].Head) != "kept in the clipboard history" {
+		t.Errorf("clipboard history lost its copy to a busy register: %+v", entries)
+	}
+	entries := clipboard.History("noisy")
+	if len(entries) != testHistorySize || string(entries[0].Head) != fmt.Sprintf("noisy copy %d", 2*testHistorySize-1) {
+		t.Fatalf("register history holds %+v, want its last %d copies", entries, testHistorySize)
+	}
+
+	// Restoring goes back into the register whose history was listed
+	post("/history", "noisy", "2")
+	if data, err := clipboard.PasteRegister("noisy"); err != nil || string(data) != string(entries[2].Head) {
+		t.Errorf("register holds %q after restoring %q (%v)", data, entries[2].Head, err)
+	}
+	if data, err := clipboard.Paste(); err != nil || string(data) != "kept in the clipboard history" {
+		t.Errorf("restoring into a register changed the clipboard to %q (%v)", data, err)
+	}
+}
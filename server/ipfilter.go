@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ipFilter restricts which source addresses may reach the server at all.
+// Denied prefixes win over allowed ones; an empty allow list allows everyone.
+type ipFilter struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+func newIPFilter(allow, deny []string) (*ipFilter, error) {
+	f := &ipFilter{}
+	var err error
+	if f.allow, err = parsePrefixes(allow); err != nil {
+		return nil, fmt.Errorf("invalid --allow-ip: %w", err)
+	}
+	if f.deny, err = parsePrefixes(deny); err != nil {
+		return nil, fmt.Errorf("invalid --deny-ip: %w", err)
+	}
+	return f, nil
+}
+
+// parsePrefixes parses CIDRs, accepting bare addresses as single-host prefixes.
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func (f *ipFilter) allowed(addr netip.Addr) bool {
+	for _, p := range f.deny {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, p := range f.allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// middleware rejects requests from disallowed source addresses with 403 before any authentication.
+func (f *ipFilter) middleware(next http.Handler) http.Handler {
+	if len(f.allow) == 0 && len(f.deny) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil || !f.allowed(addr.Unmap()) {
+			log.Printf("Rejected request from disallowed address %s", r.RemoteAddr)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"bytes"
+	"unicode"
+)
+
+// stripTrailingWhitespace removes trailing whitespace from every line of text content. Line endings,
+// CRLF included, are kept, and content that isn't text is returned untouched.
+func stripTrailingWhitespace(data []byte) []byte {
+	if !isText(data) {
+		return data
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		cr := bytes.HasSuffix(line, []byte("\r"))
+		line = bytes.TrimRightFunc(line, unicode.IsSpace)
+		if cr {
+			line = append(line, '\r')
+		}
+		lines[i] = line
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
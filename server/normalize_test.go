@@ -0,0 +1,47 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStripTrailingWhitespace(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"trailing spaces and tabs", "a  \nb\t\n", "a\nb\n"},
+		{"no trailing newline", "a \nb ", "a\nb"},
+		{"CRLF kept", "a  \r\nb\t\r\n", "a\r\nb\r\n"},
+		{"mixed endings", "a \r\nb \nc", "a\r\nb\nc"},
+		{"whitespace-only lines", "a\n   \n\t\r\n\nb", "a\n\n\r\n\nb"},
+		{"leading whitespace kept", "  a  \n\tb", "  a\n\tb"},
+		{"unicode whitespace", "a  \n", "a\n"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripTrailingWhitespace([]byte(tt.in)); string(got) != tt.want {
+				t.Errorf("stripTrailingWhitespace(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripTrailingWhitespaceLeavesBinary(t *testing.T) {
+	for _, in := range []string{
+		"a  \n\xff\xfe  \n",         // invalid UTF-8
+		"a  \nb\x00  \n",            // NUL
+		"\x89PNG\r\n\x1a\n\x00 \t ", // PNG header
+	} {
+		data := []byte(in)
+		got := stripTrailingWhitespace(data)
+		if !bytes.Equal(got, []byte(in)) {
+			t.Errorf("binary content %q was changed to %q", in, got)
+		}
+		if !bytes.Equal(data, []byte(in)) {
+			t.Errorf("binary content %q was modified in place to %q", in, data)
+		}
+	}
+}
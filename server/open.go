@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+// DefaultOpenSchemes are the URL schemes /open accepts unless configured otherwise. Schemes such as
+// file: or custom protocol handlers can launch local programs, so they must be allowed explicitly.
+var DefaultOpenSchemes = []string{"http", "https", "mailto"}
+
+// hostlessSchemes name no host, so their URLs pass --open-hosts on their scheme alone. URLs of any other
+// scheme must have a host to check, since browsers read forms such as https:evil.com or http:/evil.com,
+// which have none as far as url.Parse is concerned, as a host all the same.
+var hostlessSchemes = []string{"mailto", "tel", "sms"}
+
+// checkOpenPatterns rejects malformed --open-hosts patterns up front rather than on every request
+func checkOpenPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --open-hosts pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// checkOpenURL reports whether /open may open raw, returning the status to reject it with if not.
+// The scheme must be in config.OpenSchemes, or that must contain "*". When config.OpenHosts is set the
+// host must also match one of its patterns; only URLs of hostlessSchemes, such as mailto:, pass without one.
+func checkOpenURL(raw string) (int, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid URL: %w", err)
+	}
+	allowed := slices.ContainsFunc(config.OpenSchemes, func(scheme string) bool {
+		return scheme == "*" || strings.EqualFold(scheme, u.Scheme)
+	})
+	if !allowed {
+		return http.StatusForbidden, fmt.Errorf("URL scheme %q not allowed", u.Scheme)
+	}
+	if len(config.OpenHosts) == 0 {
+		return http.StatusOK, nil
+	}
+	if slices.ContainsFunc(hostlessSchemes, func(scheme string) bool { return strings.EqualFold(scheme, u.Scheme) }) {
+		return http.StatusOK, nil
+	}
+	host := strings.ToLower(u.Hostname())
+	if u.Opaque != "" || host == "" {
+		return http.StatusForbidden, fmt.Errorf("URL has no host to check against the allowed hosts")
+	}
+	for _, pattern := range config.OpenHosts {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+			return http.StatusOK, nil
+		}
+	}
+	return http.StatusForbidden, fmt.Errorf("URL host %q not allowed", host)
+}
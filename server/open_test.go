@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCheckOpenURLHosts(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+	config.OpenSchemes = DefaultOpenSchemes
+	config.OpenHosts = []string{"*.example.com", "example.com"}
+
+	tests := []struct {
+		url  string
+		want int
+	}{
+		{"https://example.com/page", http.StatusOK},
+		{"https://docs.example.com", http.StatusOK},
+		{"HTTPS://DOCS.EXAMPLE.COM/", http.StatusOK},
+		{"mailto:someone@evil.com", http.StatusOK},
+		{"https://evil.com", http.StatusForbidden},
+		{"https://example.com.evil.com", http.StatusForbidden},
+		// Forms without a host as url.Parse sees it, which browsers still send to evil.com
+		{`https:\\evil.com`, http.StatusForbidden},
+		{"https:evil.com/x", http.StatusForbidden},
+		{"http:/evil.com", http.StatusForbidden},
+		{"http:///evil.com", http.StatusForbidden},
+		{"https://:443/x", http.StatusForbidden},
+		{"ftp:evil.com", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			status, err := checkOpenURL(tt.url)
+			// Rejected as unparseable is as good as not allowed
+			if status == http.StatusBadRequest && tt.want == http.StatusForbidden {
+				return
+			}
+			if status != tt.want {
+				t.Errorf("checkOpenURL(%q) = %d (%v), want %d", tt.url, status, err, tt.want)
+			}
+		})
+	}
+}
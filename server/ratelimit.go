@@ -0,0 +1,174 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// tokenBucket refills at rate tokens per second up to burst. Taking more than is available
+// is allowed while the bucket is full, leaving it in debt, so one request larger than the
+// burst can still pass and is paid back before the next one.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+func (b *tokenBucket) available(n float64) bool {
+	return b.tokens >= min(n, b.burst)
+}
+
+// wait returns how long until n tokens are available
+func (b *tokenBucket) wait(n float64) time.Duration {
+	missing := min(n, b.burst) - b.tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / b.rate * float64(time.Second))
+}
+
+// full reports whether the bucket would be full by now, and so is no different from a new one
+func (b *tokenBucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// rateLimitSweepInterval is how often buckets of keys gone idle are dropped
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter throttles each key to a number of requests and bytes per second. A zero rate is unlimited.
+type rateLimiter struct {
+	mu             sync.Mutex
+	requestsPerSec float64
+	requestBurst   float64 // requests allowed back to back; the per-second rate when zero
+	bytesPerSec    float64
+	requests       map[string]*tokenBucket
+	bytes          map[string]*tokenBucket
+	lastSweep      time.Time
+}
+
+func newRateLimiter(requestsPerSec, requestBurst, bytesPerSec float64) *rateLimiter {
+	if requestBurst <= 0 {
+		requestBurst = requestsPerSec
+	}
+	return &rateLimiter{
+		requestsPerSec: requestsPerSec,
+		requestBurst:   requestBurst,
+		bytesPerSec:    bytesPerSec,
+		requests:       make(map[string]*tokenBucket),
+		bytes:          make(map[string]*tokenBucket),
+		lastSweep:      time.Now(),
+	}
+}
+
+// allow reports whether key may make a request of size bytes now, and charges it if so.
+// Otherwise it returns how long until the request would be allowed.
+func (l *rateLimiter) allow(key string, size int) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if wait := l.waitLocked(key, size); wait > 0 {
+		return false, wait
+	}
+	l.chargeLocked(key, size)
+	return true, 0
+}
+
+// check returns how long until key may make a request of size bytes, zero if it may now, without charging it.
+// Requests checked at the same time may all pass and then be charged, leaving the buckets in debt.
+func (l *rateLimiter) check(key string, size int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.waitLocked(key, size)
+}
+
+// charge takes a request of size bytes from key's allowance, once check let it through
+func (l *rateLimiter) charge(key string, size int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.chargeLocked(key, size)
+}
+
+// waitLocked is check with l.mu held
+func (l *rateLimiter) waitLocked(key string, size int) time.Duration {
+	now := time.Now()
+	l.sweep(now)
+	var wait time.Duration
+	if b := l.bucket(l.requests, key, l.requestsPerSec, l.requestBurst, now); b != nil && !b.available(1) {
+		wait = b.wait(1)
+	}
+	if b := l.bucket(l.bytes, key, l.bytesPerSec, l.bytesPerSec, now); b != nil && !b.available(float64(size)) {
+		wait = max(wait, b.wait(float64(size)))
+	}
+	return wait
+}
+
+// chargeLocked is charge with l.mu held
+func (l *rateLimiter) chargeLocked(key string, size int) {
+	now := time.Now()
+	if b := l.bucket(l.requests, key, l.requestsPerSec, l.requestBurst, now); b != nil {
+		b.tokens--
+	}
+	if b := l.bucket(l.bytes, key, l.bytesPerSec, l.bytesPerSec, now); b != nil {
+		b.tokens -= float64(size)
+	}
+}
+
+// bucket returns key's bucket in buckets, refilled up to now, or nil when rate is unlimited.
+func (l *rateLimiter) bucket(buckets map[string]*tokenBucket, key string, rate, burst float64, now time.Time) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	b, ok := buckets[key]
+	if !ok {
+		b = newTokenBucket(rate, burst)
+		buckets[key] = b
+	}
+	b.refill(now)
+	return b
+}
+
+// sweep drops the buckets of keys idle long enough for them to refill, so the maps don't
+// grow with every key ever seen. Dropping a full bucket changes nothing, as it is recreated full.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for _, buckets := range []map[string]*tokenBucket{l.requests, l.bytes} {
+		for key, b := range buckets {
+			if b.full(now) {
+				delete(buckets, key)
+			}
+		}
+	}
+}
+
+// requestLimiter throttles every authenticated request per key when --rate-limit is set. authMiddleware
+// consults it once it knows the key, and charges a request only once its signature verifies, so a client
+// can neither spend another key's allowance by sending its fingerprint nor make the server read and
+// verify bodies for a key that is over its limit.
+var requestLimiter *rateLimiter
+
+// tooManyRequests answers 429 with a Retry-After of wait, rounded up to whole seconds
+func tooManyRequests(w http.ResponseWriter, message string, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	http.Error(w, fmt.Sprintf("%s, retry in %ds", message, max(seconds, 1)), http.StatusTooManyRequests)
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"pb/util"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// testSigner returns a fresh ed25519 signer
+func testSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// countingReader counts reads of a request body
+type countingReader struct {
+	io.Reader
+	reads *atomic.Int32
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	r.reads.Add(1)
+	return r.Reader.Read(p)
+}
+
+// signedRequest builds a request for body claiming fingerprint and signed by signer, which needn't hold that key
+func signedRequest(t *testing.T, signer ssh.Signer, fingerprint, body string, reads *atomic.Int32) *http.Request {
+	t.Helper()
+	digest, err := util.SignatureDigest(util.DefaultSignatureHash, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := signer.Sign(rand.Reader, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/copy", countingReader{strings.NewReader(body), reads})
+	r.Header.Set(util.HeaderFingerprint, fingerprint)
+	r.Header.Set(util.HeaderSignature, base64.StdEncoding.EncodeToString(ssh.Marshal(signature)))
+	return r
+}
+
+func TestAuthMiddlewareRateLimit(t *testing.T) {
+	savedLimiter, savedHashes := requestLimiter, config.SignatureHashes
+	t.Cleanup(func() { requestLimiter, config.SignatureHashes = savedLimiter, savedHashes })
+	config.SignatureHashes = []string{util.DefaultSignatureHash}
+	// A burst of 2 that practically never refills during the test
+	requestLimiter = newRateLimiter(0.001, 2, 0)
+
+	signer, forger := testSigner(t), testSigner(t)
+	fingerprint := ssh.FingerprintSHA256(signer.PublicKey())
+	keys := map[string]authorizedKey{fingerprint: {pubKey: signer.PublicKey()}}
+	var handled atomic.Int32
+	handler := authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled.Add(1)
+	}), keys)
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// Requests claiming the key without holding it fail verification and leave its allowance alone
+	var reads atomic.Int32
+	for i := 0; i < 5; i++ {
+		if w := serve(signedRequest(t, forger, fingerprint, "forged", &reads)); w.Code != http.StatusUnauthorized {
+			t.Fatalf("forged request %d answered %d, want %d", i, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := serve(signedRequest(t, signer, fingerprint, "genuine", &reads)); w.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst answered %d: %s", i, w.Code, w.Body)
+		}
+	}
+	if n := handled.Load(); n != 2 {
+		t.Fatalf("%d requests reached the handler, want 2", n)
+	}
+
+	reads.Store(0)
+	w := serve(signedRequest(t, signer, fingerprint, "over the limit", &reads))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the burst answered %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+	if n := reads.Load(); n != 0 {
+		t.Errorf("the body of a request over the limit was read %d times", n)
+	}
+	if n := handled.Load(); n != 2 {
+		t.Errorf("a request over the limit reached the handler")
+	}
+}
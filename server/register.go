@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"pb/clipboard"
+	"pb/util"
+	"strings"
+)
+
+type contextKey int
+
+const fingerprintKey contextKey = iota
+
+// withFingerprint records the fingerprint of the key that authenticated the request.
+func withFingerprint(ctx context.Context, fingerprint string) context.Context {
+	return context.WithValue(ctx, fingerprintKey, fingerprint)
+}
+
+// requestFingerprint returns the fingerprint of the key that authenticated the request, if any.
+func requestFingerprint(r *http.Request) string {
+	fingerprint, _ := r.Context().Value(fingerprintKey).(string)
+	return fingerprint
+}
+
+// requestRegister returns the register a copy or paste request operates on.
+// An empty name means the shared clipboard; in per-key mode each key gets a register named
+// after its fingerprint unless the client asks for the shared one. Any other name selects a
+// named register, which every key can use like a key-value store. A namespace scopes all of
+// them to registers of their own, so teams on one server don't collide.
+func requestRegister(r *http.Request) (string, error) {
+	namespace := r.Header.Get(util.HeaderNamespace)
+	if strings.Contains(namespace, "/") {
+		return "", fmt.Errorf("invalid namespace %q: must not contain '/'", namespace)
+	}
+
+	var name string
+	switch register := r.Header.Get(util.HeaderRegister); register {
+	case "":
+		if config.PerKeyClipboard {
+			name = requestFingerprint(r)
+		}
+	case util.RegisterShared:
+	default:
+		// Fingerprints contain ':', so reserving it keeps named registers apart from per-key ones
+		if strings.ContainsAny(register, "/:") {
+			return "", fmt.Errorf("invalid register %q: must not contain '/' or ':'", register)
+		}
+		name = register
+	}
+
+	if namespace == "" {
+		return name, nil
+	}
+	if name == "" {
+		name = util.RegisterShared
+	}
+	return namespace + "/" + name, nil
+}
+
+// isNamedRegister reports whether the request selects a named register rather than a clipboard.
+func isNamedRegister(r *http.Request) bool {
+	register := r.Header.Get(util.HeaderRegister)
+	return register != "" && register != util.RegisterShared
+}
+
+// registersHandler lists the named registers in the request's namespace, one per line.
+func registersHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := r.Header.Get(util.HeaderNamespace)
+	if strings.Contains(namespace, "/") {
+		http.Error(w, fmt.Sprintf("invalid namespace %q: must not contain '/'", namespace), http.StatusBadRequest)
+		return
+	}
+
+	prefix := ""
+	if namespace != "" {
+		prefix = namespace + "/"
+	}
+
+	var names []string
+	for _, name := range clipboard.RegisterNames() {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		name = strings.TrimPrefix(name, prefix)
+		// Skip per-key registers, the namespace's shared one and registers in other namespaces
+		if name == util.RegisterShared || strings.ContainsAny(name, "/:") {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, name := range names {
+		fmt.Fprintln(w, name)
+	}
+}
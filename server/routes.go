@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"pb/util"
+)
+
+// endpoint describes a route served by the server. The table doubles as lightweight API documentation
+// returned to clients that request an unknown route.
+type endpoint struct {
+	Path          string `json:"path"`
+	Methods       string `json:"methods"`
+	Authenticated bool   `json:"authenticated"`
+	Description   string `json:"description"`
+	handler       http.HandlerFunc
+}
+
+var endpoints = []endpoint{
+	{util.RequestCopy, "POST", true, "Replaces the clipboard with the request body", copyHandler},
+	{util.RequestClear, "POST", true, "Empties the clipboard", clearHandler},
+	{util.RequestPaste, "GET", true, "Returns the clipboard content", pasteHandler},
+	{util.RequestSize, "GET", true, "Returns the clipboard content size in bytes without the content", sizeHandler},
+	{util.RequestRegisters, "GET", true, "Lists the named registers, one per line", registersHandler},
+	{util.RequestHistory, "GET, POST", true, "Lists recent copies (GET), or restores the one whose index is the request body (POST)", historyHandler},
+	{util.RequestWatch, "GET", true, "Streams the clipboard content each time it changes, as server-sent events", watchHandler},
+	{util.RequestWatchers, "GET", true, "Lists the clients subscribed to clipboard changes", watchersHandler},
+	{util.RequestBackup, "POST", true, "Writes the clipboard to the file named in the request body, relative to the server's backup directory", backupHandler},
+	{util.RequestOpen, "POST", true, "Opens the URL in the request body on the server", openHandler},
+	{util.RequestQuit, "POST", true, "Shuts the server down", quitHandler},
+	{util.RequestStatus, "GET", true, "Reports the server version, uptime and which clipboard backend is active", statusHandler},
+	{util.RequestVersion, "GET", true, "Returns the server version and advertises its capabilities", versionHandler},
+	{util.RequestHealthz, "GET", false, "Returns 200 when healthy, 503 when serving from the in-memory fallback", healthzHandler},
+}
+
+// registerRoutes adds every endpoint to the public or the authenticated mux, plus a catch-all for unknown routes.
+func registerRoutes(public, authenticated *http.ServeMux) {
+	for _, e := range endpoints {
+		if e.Authenticated {
+			authenticated.HandleFunc(e.Path, e.handler)
+		} else {
+			public.HandleFunc(e.Path, e.handler)
+		}
+	}
+	authenticated.HandleFunc("/", unknownRouteHandler)
+}
+
+// unknownRouteHandler answers unknown routes with a 404 listing the valid endpoints.
+func unknownRouteHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(struct {
+		Error     string     `json:"error"`
+		Endpoints []endpoint `json:"endpoints"`
+	}{
+		Error:     "unknown endpoint " + r.URL.Path,
+		Endpoints: endpoints,
+	})
+}
@@ -6,106 +6,448 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"github.com/skratchdot/open-golang/open"
 	"golang.org/x/crypto/ssh"
 	"io"
 	"log"
 	"math/big"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"pb/clipboard"
 	"pb/util"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
 )
 
-// Serve starts the HTTPS server.
-func Serve(ctx context.Context, port int, le string, fallback bool, useCliTool bool) error {
+// authorizedKey is a public key from authorized_keys along with the restrictions parsed from its options.
+type authorizedKey struct {
+	pubKey    ssh.PublicKey
+	expiresAt time.Time // zero when the key never expires
+	group     string    // from a group:NAME tag in the comment, empty when untagged
+}
+
+// Options configures the server.
+type Options struct {
+	Port       int
+	Bind       string // IP address to listen on; empty means all interfaces
+	LineEnding string
+	Fallback   bool // use the in-memory clipboard
+	UseCliTool bool // use CLI clipboard tools
+	NoTLS      bool // serve plain HTTP; requests stay signed but travel unencrypted
+
+	// ClipboardTimeout is how long a system clipboard operation may take before the fallback takes
+	// over, HealthInterval how often a failed one is polled for recovery; zero keeps the defaults
+	ClipboardTimeout time.Duration
+	HealthInterval   time.Duration
+
+	// ManagerCompatDelay, when positive, verifies system clipboard writes after this delay
+	// and retries once if a clipboard manager altered them
+	ManagerCompatDelay time.Duration
+
+	// ReplayOnRecovery copies the last fallback content into the system clipboard when it recovers
+	ReplayOnRecovery bool
+
+	// AllowIPs and DenyIPs are CIDRs (or bare addresses) restricting which clients may connect
+	AllowIPs []string
+	DenyIPs  []string
+
+	// PerKeyClipboard gives every authorized key its own in-memory clipboard instead of the shared one
+	PerKeyClipboard bool
+
+	// CopyFilter and PasteFilter are commands content is piped through on copy and paste,
+	// each run killed after FilterTimeout
+	CopyFilter    string
+	PasteFilter   string
+	FilterTimeout time.Duration
+
+	// NormalizeTrailing strips trailing whitespace from each line of copied text; binary content is never changed
+	NormalizeTrailing bool
+
+	// AnnotateFormat, when set, is a text/template prepended to copied text recording
+	// {{.Fingerprint}} and {{.Time}}; binary content is never annotated
+	AnnotateFormat string
+
+	// MaxSize, when positive, rejects request bodies over this many bytes with 413, both as sent
+	// and once decompressed
+	MaxSize int64
+
+	// SpillThreshold, when positive, moves in-memory clipboard content above this many bytes to a temp file
+	SpillThreshold int64
+
+	// Passphrase, when set, requires copies to be encrypted with it and encrypts pastes with it
+	Passphrase string
+
+	// SignatureHashes are the hashes clients may digest request bodies with before signing them
+	SignatureHashes []string
+
+	// CertValidity is how long a newly generated self-signed certificate is valid for
+	CertValidity time.Duration
+
+	// CopyRequestsPerSec and CopyBytesPerSec throttle each key's copies; zero is unlimited
+	CopyRequestsPerSec float64
+	CopyBytesPerSec    float64
+
+	// RequestsPerSec throttles all of each key's authenticated requests, allowing RequestBurst
+	// of them back to back (RequestsPerSec when zero); zero is unlimited
+	RequestsPerSec float64
+	RequestBurst   int
+
+	// Retries is how many more times a failing system clipboard operation is tried before
+	// switching to the fallback, RetryBackoff the wait before the first retry, doubled after each
+	Retries      int
+	RetryBackoff time.Duration
+
+	// BackendOverride lets a request pick the clipboard backend for itself with X-PB-Backend
+	BackendOverride bool
+
+	// MaxOpenURLLength rejects /open requests for longer URLs; zero is unlimited
+	MaxOpenURLLength int
+
+	// OpenSchemes are the URL schemes /open accepts, "*" for any; OpenHosts, when set, are
+	// path.Match patterns such as *.example.com the URL's host must match
+	OpenSchemes []string
+	OpenHosts   []string
+
+	// HistorySize is how many recent copies /history keeps for the clipboard and for each register;
+	// zero disables history. HistoryMaxBytes bounds how much content each of those histories holds,
+	// dropping the oldest first; zero is unlimited
+	HistorySize     int
+	HistoryMaxBytes int64
+
+	// HistoryFile, when set, keeps the history as JSON across restarts, leaving out entries larger
+	// than HistoryFileLimit (zero for no limit)
+	HistoryFile      string
+	HistoryFileLimit int64
+
+	// BackupDir is the only directory /backup may write clipboard snapshots into; empty disables backups
+	BackupDir string
+
+	// ClientCA, when set, is a PEM file of CAs client certificates must be signed by. Clients
+	// without one are rejected during the TLS handshake and requests skip the signature check.
+	ClientCA string
+}
+
+// DefaultMaxSize matches the size limit clients enforce unless told --rosebud
+const DefaultMaxSize = 200 * 1024 * 1024
+
+// DefaultBind listens on all interfaces, as the server always has
+const DefaultBind = "0.0.0.0"
+
+// DefaultHistorySize is how many recent copies are kept unless configured otherwise
+const DefaultHistorySize = 20
+
+// DefaultHistoryMaxBytes bounds the content history holds unless configured otherwise, so remembering
+// DefaultHistorySize copies of up to DefaultMaxSize each can't take gigabytes
+const DefaultHistoryMaxBytes = 64 * 1024 * 1024
+
+// DefaultHistoryFileLimit keeps large copies, typically images, out of the history file unless
+// configured otherwise, since the whole file is rewritten on every copy
+const DefaultHistoryFileLimit = 1024 * 1024
+
+// DefaultMaxOpenURLLength bounds URLs sent to /open unless configured otherwise. Real URLs are rarely
+// over a few KB, while browsers and URL handlers may choke on much longer ones.
+const DefaultMaxOpenURLLength = 8 * 1024
+
+// DefaultCertValidity is the lifetime of generated self-signed certificates unless configured otherwise.
+const DefaultCertValidity = 365 * 24 * time.Hour
+
+// annotateTemplate is parsed from Options.AnnotateFormat when the server starts
+var annotateTemplate *template.Template
+
+// copyLimiter throttles copies per key when a copy rate limit is configured
+var copyLimiter *rateLimiter
+
+// config holds the options the server was started with, for handlers to consult
+var config Options
+
+// startTime is when Serve started, for /status to report uptime
+var startTime time.Time
+
+// shutdown asks Serve to stop gracefully, and stopping is closed once it has been asked to,
+// so long-lived handlers such as /watch can end and let in-flight requests drain
+var (
+	shutdown context.CancelFunc
+	stopping <-chan struct{}
+)
+
+// shutdownTimeout bounds how long in-flight requests may take to finish once the server stops
+const shutdownTimeout = 10 * time.Second
+
+// Serve starts the HTTPS server. It stops gracefully, letting in-flight requests finish, when ctx
+// is cancelled or a client sends /quit.
+func Serve(ctx context.Context, opts Options) error {
+	ctx, shutdown = context.WithCancel(ctx)
+	defer shutdown()
+	stopping = ctx.Done()
+
 	// Initialize clipboard with logging enabled (server logs clipboard operations)
 	clipboard.EnableLogging()
+	if opts.ClipboardTimeout < 0 || opts.HealthInterval < 0 {
+		return fmt.Errorf("--clipboard-timeout and --health-interval must not be negative")
+	}
+	clipboard.SetTimeouts(opts.ClipboardTimeout, opts.HealthInterval)
 	if err := clipboard.Init(); err != nil {
 		return fmt.Errorf("failed to initialize clipboard: %w", err)
 	}
+	// Spilled content is often sensitive, so don't leave it behind in the temp dir
+	defer func() {
+		if err := clipboard.RemoveSpillFiles(); err != nil {
+			log.Printf("Failed to remove spill files: %v", err)
+		}
+	}()
 
 	// Handle clipboard flag priority: --fallback overrides --use-cli-tool
-	if fallback {
+	if opts.Fallback {
 		clipboard.UseInMemoryClipboard()
-	} else if useCliTool {
+	} else if opts.UseCliTool {
 		if err := clipboard.UseCliClipboard(); err != nil {
 			return fmt.Errorf("--use-cli-tool flag set but CLI tools not available: %w", err)
 		}
 	}
 
-	home, err := os.UserHomeDir()
+	if opts.ReplayOnRecovery {
+		clipboard.EnableReplayOnRecovery()
+	}
+	if opts.SpillThreshold > 0 {
+		clipboard.EnableSpill(opts.SpillThreshold)
+	}
+	if opts.Retries > 0 {
+		clipboard.EnableRetry(opts.Retries, opts.RetryBackoff)
+	}
+	if opts.HistoryMaxBytes < 0 {
+		return fmt.Errorf("--history-max-bytes must not be negative")
+	}
+	if opts.HistorySize > 0 {
+		clipboard.EnableHistory(opts.HistorySize, opts.HistoryMaxBytes)
+		if opts.HistoryFile != "" {
+			if err := clipboard.EnableHistoryFile(opts.HistoryFile, opts.HistoryFileLimit); err != nil {
+				return fmt.Errorf("invalid --history-file: %w", err)
+			}
+		}
+	} else if opts.HistoryFile != "" {
+		return fmt.Errorf("--history-file needs history enabled with --history-size")
+	}
+	if opts.ManagerCompatDelay > 0 {
+		clipboard.EnableManagerCompat(opts.ManagerCompatDelay)
+	}
+
+	if len(opts.SignatureHashes) == 0 {
+		opts.SignatureHashes = []string{util.DefaultSignatureHash}
+	}
+	if err := util.ValidSignatureHashes(opts.SignatureHashes); err != nil {
+		return fmt.Errorf("invalid --signature-hashes: %w", err)
+	}
+	if opts.Bind == "" {
+		opts.Bind = DefaultBind
+	}
+	if net.ParseIP(opts.Bind) == nil {
+		return fmt.Errorf("invalid --bind address %q: must be an IP address such as 127.0.0.1", opts.Bind)
+	}
+	if len(opts.OpenSchemes) == 0 {
+		opts.OpenSchemes = DefaultOpenSchemes
+	}
+	if err := checkOpenPatterns(opts.OpenHosts); err != nil {
+		return err
+	}
+	if opts.BackupDir != "" {
+		dir, err := checkBackupDir(opts.BackupDir)
+		if err != nil {
+			return fmt.Errorf("invalid --backup-dir: %w", err)
+		}
+		opts.BackupDir = dir
+	}
+	config = opts
+	startTime = time.Now()
+	if opts.AnnotateFormat != "" {
+		tmpl, err := parseAnnotateFormat(opts.AnnotateFormat)
+		if err != nil {
+			return err
+		}
+		annotateTemplate = tmpl
+	}
+	if opts.CopyRequestsPerSec > 0 || opts.CopyBytesPerSec > 0 {
+		copyLimiter = newRateLimiter(opts.CopyRequestsPerSec, 0, opts.CopyBytesPerSec)
+	}
+	if opts.RequestsPerSec > 0 {
+		requestLimiter = newRateLimiter(opts.RequestsPerSec, float64(opts.RequestBurst), 0)
+	}
+
+	filter, err := newIPFilter(opts.AllowIPs, opts.DenyIPs)
+	if err != nil {
+		return err
+	}
+
+	configDir, err := util.ConfigDir()
 	if err != nil {
-		return fmt.Errorf("could not get user home directory: %w", err)
+		return err
 	}
 
-	authorizedKeys, err := loadAuthorizedKeys(filepath.Join(home, ".config", util.ProgramName, "authorized_keys"))
+	authorizedKeys, err := loadAuthorizedKeys(filepath.Join(configDir, "authorized_keys"))
 	if err != nil {
 		return fmt.Errorf("could not load authorized keys: %w", err)
 	}
 
-	certPath := filepath.Join(home, ".config", util.ProgramName, "cert.pem")
-	keyPath := filepath.Join(home, ".config", util.ProgramName, "key.pem")
+	certPath := filepath.Join(configDir, "cert.pem")
+	keyPath := filepath.Join(configDir, "key.pem")
 
-	if err := generateSelfSignedCert(certPath, keyPath); err != nil {
-		return fmt.Errorf("could not generate self-signed certificate: %w", err)
+	if opts.NoTLS && opts.ClientCA != "" {
+		return fmt.Errorf("--client-ca needs TLS and cannot be used with --no-tls")
+	}
+	if !opts.NoTLS {
+		if opts.CertValidity <= 0 {
+			return fmt.Errorf("certificate validity must be positive, got %s", opts.CertValidity)
+		}
+		if err := generateSelfSignedCert(certPath, keyPath, opts.CertValidity, opts.Bind); err != nil {
+			return fmt.Errorf("could not generate self-signed certificate: %w", err)
+		}
 	}
 
+	// Public routes such as the health check are unauthenticated so load balancers and monitors can probe them
+	root := http.NewServeMux()
 	mux := http.NewServeMux()
-	mux.HandleFunc(util.RequestCopy, copyHandler)
-	mux.HandleFunc(util.RequestPaste, pasteHandler)
-	mux.HandleFunc(util.RequestOpen, openHandler)
-	mux.HandleFunc(util.RequestQuit, quitHandler)
+	registerRoutes(root, mux)
+	root.Handle("/", limitBodyMiddleware(authMiddleware(decompressMiddleware(mux), authorizedKeys)))
 
-	addr := fmt.Sprintf("0.0.0.0:%d", port)
+	addr := net.JoinHostPort(opts.Bind, strconv.Itoa(opts.Port))
 	server := &http.Server{
 		Addr:    addr,
-		Handler: authMiddleware(mux, authorizedKeys),
+		Handler: filter.middleware(capabilitiesMiddleware(root)),
+	}
+	if opts.ClientCA != "" {
+		tlsConfig, err := clientCATLSConfig(opts.ClientCA)
+		if err != nil {
+			return fmt.Errorf("could not load --client-ca: %w", err)
+		}
+		server.TLSConfig = tlsConfig
 	}
 
+	// ListenAndServe returns as soon as Shutdown starts, so Serve waits for it to finish draining
+	drained := make(chan struct{})
 	go func() {
+		defer close(drained)
 		<-ctx.Done()
-		server.Shutdown(context.Background())
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Requests still running after %s were cut off: %v", shutdownTimeout, err)
+		}
 	}()
 
+	if opts.NoTLS {
+		log.Printf("%s server listening on %s without TLS: requests are authenticated but NOT encrypted in transit", util.ProgramName, addr)
+		return stopped(server.ListenAndServe(), drained)
+	}
+
+	if certPEM, err := os.ReadFile(certPath); err == nil {
+		if fingerprint, err := certFingerprint(certPEM); err == nil {
+			log.Printf("Certificate key SHA256 fingerprint: %s", fingerprint)
+		}
+	}
+	if opts.ClientCA != "" {
+		log.Printf("Requiring client certificates signed by %s", opts.ClientCA)
+	}
 	log.Printf("%s server listening on %s", util.ProgramName, addr)
-	return server.ListenAndServeTLS(certPath, keyPath)
+	return stopped(server.ListenAndServeTLS(certPath, keyPath), drained)
+}
+
+// stopped turns the error ListenAndServe returns once Shutdown starts into a clean stop, after waiting
+// for in-flight requests to drain; any other error is returned as is
+func stopped(err error, drained <-chan struct{}) error {
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-drained
+	log.Println("Server stopped")
+	return nil
 }
 
-func authMiddleware(next http.Handler, authorizedKeys map[string]ssh.PublicKey) http.Handler {
+func authMiddleware(next http.Handler, authorizedKeys map[string]authorizedKey) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The TLS handshake already authenticated the client, so the body needn't be read and signed
+		if cert := verifiedClientCert(r); cert != nil && config.ClientCA != "" {
+			fingerprint := clientCertFingerprint(cert)
+			if requestLimiter != nil {
+				if ok, wait := requestLimiter.allow(fingerprint, 0); !ok {
+					tooManyRequests(w, "Rate limit exceeded", wait)
+					return
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(withFingerprint(r.Context(), fingerprint)))
+			return
+		}
+
 		keyFingerprint := r.Header.Get(util.HeaderFingerprint)
 		signatureB64 := r.Header.Get(util.HeaderSignature)
 
-		if keyFingerprint == "" || signatureB64 == "" {
+		// Streamed bodies carry their signature in a trailer, which is only known once the body is read
+		_, signatureInTrailer := r.Trailer[http.CanonicalHeaderKey(util.HeaderSignature)]
+		if keyFingerprint == "" || (signatureB64 == "" && !signatureInTrailer) {
 			http.Error(w, "Missing authentication headers", http.StatusUnauthorized)
 			return
 		}
 
-		pubKey, ok := authorizedKeys[keyFingerprint]
+		key, ok := authorizedKeys[keyFingerprint]
 		if !ok {
 			http.Error(w, "Unknown public key", http.StatusUnauthorized)
 			return
 		}
 
-		body, err := io.ReadAll(r.Body)
+		if !key.expiresAt.IsZero() && time.Now().After(key.expiresAt) {
+			http.Error(w, fmt.Sprintf("Public key expired at %s", key.expiresAt.Format(time.RFC3339)), http.StatusUnauthorized)
+			return
+		}
+
+		// Over the limit, the body isn't even read. The request is only charged once its signature
+		// verifies though, so requests merely claiming the fingerprint can't use up the key's allowance.
+		if requestLimiter != nil {
+			if wait := requestLimiter.check(keyFingerprint, 0); wait > 0 {
+				tooManyRequests(w, "Rate limit exceeded", wait)
+				return
+			}
+		}
+
+		body, err := readBody(r)
 		if err != nil {
-			http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+			readBodyFailed(w, err)
 			return
 		}
 
-		// Because ReadAll consumes the body, we need to put it back for the actual handler.
-		r.Body = io.NopCloser(bytes.NewBuffer(body))
+		// Reading consumes the body, so hand the buffer on to the actual handler, which takes it
+		// over with readBody rather than copying it
+		r.Body = &bufferedBody{Reader: bytes.NewReader(body), data: body}
 
-		hash := sha256.Sum256(body)
+		if signatureB64 == "" {
+			if signatureB64 = r.Trailer.Get(util.HeaderSignature); signatureB64 == "" {
+				http.Error(w, "Missing authentication headers", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		// Only hashes on the allowlist are accepted, so a client can't be talked down to a weaker one
+		hashName := r.Header.Get(util.HeaderSignatureHash)
+		if hashName == "" {
+			hashName = util.DefaultSignatureHash
+		}
+		if !slices.Contains(config.SignatureHashes, hashName) {
+			http.Error(w, fmt.Sprintf("Signature hash %q not allowed", hashName), http.StatusForbidden)
+			return
+		}
+		digest, err := util.SignatureDigest(hashName, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 
 		signatureBytes, err := base64.StdEncoding.DecodeString(signatureB64)
 		if err != nil {
@@ -119,55 +461,315 @@ func authMiddleware(next http.Handler, authorizedKeys map[string]ssh.PublicKey)
 			return
 		}
 
-		if err := pubKey.Verify(hash[:], sshSig); err != nil {
+		if err := key.pubKey.Verify(digest, sshSig); err != nil {
 			http.Error(w, "Signature verification failed", http.StatusUnauthorized)
 			return
 		}
+		if requestLimiter != nil {
+			requestLimiter.charge(keyFingerprint, 0)
+		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(withFingerprint(r.Context(), keyFingerprint)))
 	})
 }
 
 func copyHandler(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	body, err := readBody(r)
+	if err != nil {
+		readBodyFailed(w, err)
+		return
+	}
+
+	if copyLimiter != nil {
+		if ok, wait := copyLimiter.allow(requestFingerprint(r), len(body)); !ok {
+			tooManyRequests(w, "Copy rate limit exceeded", wait)
+			return
+		}
+	}
+
+	if config.Passphrase != "" {
+		if r.Header.Get(util.HeaderEncryption) != util.EncryptionPassphrase {
+			http.Error(w, "This server requires passphrase-encrypted copies, set --passphrase", http.StatusBadRequest)
+			return
+		}
+		if body, err = util.DecryptWithPassphrase(config.Passphrase, body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	register, err := requestRegister(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	backend, status, err := requestBackend(r, register)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	format, err := copyFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if format == clipboard.FormatImage && backend != "" {
+		http.Error(w, "Backend override only supports text", http.StatusBadRequest)
+		return
+	}
+
+	ttl, err := requestTTL(r, register, backend)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if config.CopyFilter != "" {
+		if body, err = runFilter(config.CopyFilter, body); err != nil {
+			log.Printf("Rejected copy: %v", err)
+			http.Error(w, "Copy filter failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Content encrypted end to end can't be normalized or annotated without corrupting it
+	opaque := r.Header.Get(util.HeaderOpaque) == "true"
+	if config.NormalizeTrailing && format == clipboard.FormatText && !opaque {
+		body = stripTrailingWhitespace(body)
+	}
+
+	if annotateTemplate != nil && !opaque {
+		if body, err = annotate(annotateTemplate, body, requestFingerprint(r)); err != nil {
+			http.Error(w, "Failed to annotate content", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	clipboard.LockWrites()
+	defer clipboard.UnlockWrites()
+	if match := r.Header.Get("If-Match"); match != "" && !versionMatches(match, clipboard.Version(register)) {
+		http.Error(w, "Clipboard changed since it was read, paste it again and retry", http.StatusPreconditionFailed)
 		return
 	}
 
-	if err := clipboard.Copy(body); err != nil {
+	switch {
+	case register != "":
+		err = clipboard.CopyRegisterAs(register, format, body)
+	case backend != "":
+		err = clipboard.CopyWithBackend(backend, body)
+	case ttl > 0:
+		err = clipboard.CopyExpiring(format, body, ttl)
+	default:
+		err = clipboard.CopyAs(format, body)
+	}
+	if err != nil && backend != "" {
+		// Overrides are for debugging backends, so say why the chosen one failed
+		http.Error(w, fmt.Sprintf("Clipboard backend %s failed: %v", backend, err), http.StatusInternalServerError)
+		return
+	}
+	if errors.Is(err, clipboard.ErrTargetUnavailable) {
+		http.Error(w, fmt.Sprintf("The clipboard can't hold %s content: %v", format, err), http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
 		http.Error(w, "Failed to write to clipboard", http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("ETag", versionETag(clipboard.Version(register)))
 	w.WriteHeader(http.StatusOK)
 	log.Println("Copy request successfully handled")
 }
 
+// clearHandler empties the clipboard, or the request's register.
+func clearHandler(w http.ResponseWriter, r *http.Request) {
+	register, err := requestRegister(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clipboard.LockWrites()
+	defer clipboard.UnlockWrites()
+	if register != "" {
+		err = clipboard.ClearRegister(register)
+	} else {
+		err = clipboard.Clear()
+	}
+	if err != nil {
+		http.Error(w, "Failed to clear clipboard", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", versionETag(clipboard.Version(register)))
+	log.Println("Clear request successfully handled")
+}
+
 func pasteHandler(w http.ResponseWriter, r *http.Request) {
-	content, err := clipboard.Paste()
+	register, err := requestRegister(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	backend, status, err := requestBackend(r, register)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if isNamedRegister(r) && !clipboard.HasRegister(register) {
+		http.Error(w, fmt.Sprintf("No register named %q", r.Header.Get(util.HeaderRegister)), http.StatusNotFound)
+		return
+	}
+
+	format := pasteFormat(r)
+	if format == clipboard.FormatImage && backend != "" {
+		http.Error(w, "Backend override only supports text", http.StatusBadRequest)
+		return
+	}
+
+	// Read the version first: should a copy land in between, the client gets a stale version and its
+	// If-Match fails, rather than a fresh version for stale content
+	version := clipboard.Version(register)
+
+	// Spilled content is streamed from its file rather than read into memory, unless it must be transformed first
+	var spilled io.ReadCloser
+	var spilledSize int64
+	if backend == "" && config.PasteFilter == "" && config.Passphrase == "" {
+		if spilled, spilledSize, err = clipboard.OpenSpilled(register, format); err != nil {
+			log.Printf("Failed to open spilled clipboard content: %v", err)
+			http.Error(w, "Failed to read from clipboard", http.StatusInternalServerError)
+			return
+		}
+		if spilled != nil {
+			defer spilled.Close()
+		}
+	}
+
+	var content []byte
+	switch {
+	case spilled != nil:
+	case register != "":
+		content, err = clipboard.PasteRegisterAs(register, format)
+	case backend != "":
+		content, err = clipboard.PasteWithBackend(backend)
+	default:
+		content, err = clipboard.PasteAs(format)
+	}
+	if err != nil && backend != "" {
+		// Overrides are for debugging backends, so say why the chosen one failed
+		http.Error(w, fmt.Sprintf("Clipboard backend %s failed: %v", backend, err), http.StatusInternalServerError)
+		return
+	}
+	if errors.Is(err, clipboard.ErrTargetUnavailable) {
+		http.Error(w, fmt.Sprintf("Clipboard has no %s content", format), http.StatusNotAcceptable)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to read from clipboard", http.StatusInternalServerError)
 		return
 	}
 
-	if _, err := w.Write(content); err != nil {
+	if config.PasteFilter != "" {
+		if content, err = runFilter(config.PasteFilter, content); err != nil {
+			log.Printf("Rejected paste: %v", err)
+			http.Error(w, "Paste filter failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Let clients know when the content came from the degraded in-memory fallback.
+	// Per-key registers are always in memory by design, so they are not reported as degraded.
+	switch {
+	case register != "":
+		w.Header().Set(util.HeaderBackend, clipboard.BackendMemory)
+		w.Header().Set(util.HeaderDegraded, "false")
+	case backend != "":
+		w.Header().Set(util.HeaderBackend, backend)
+		w.Header().Set(util.HeaderDegraded, "false")
+	default:
+		w.Header().Set(util.HeaderBackend, clipboard.ActiveBackend())
+		w.Header().Set(util.HeaderDegraded, strconv.FormatBool(clipboard.IsUsingFallback()))
+		setExpiresIn(w)
+	}
+
+	w.Header().Set("ETag", versionETag(version))
+	if format == clipboard.FormatImage {
+		w.Header().Set("Content-Type", clipboard.ImageMIMEType)
+	}
+
+	// Advertise the size up front so clients can refuse oversized pastes before downloading them
+	if spilled != nil {
+		w.Header().Set(util.HeaderContentSize, strconv.FormatInt(spilledSize, 10))
+		err = writeBodyFrom(w, r, spilled, spilledSize)
+	} else {
+		w.Header().Set(util.HeaderContentSize, strconv.Itoa(len(content)))
+		if config.Passphrase != "" {
+			if content, err = util.EncryptWithPassphrase(config.Passphrase, content); err != nil {
+				http.Error(w, "Failed to encrypt clipboard content", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set(util.HeaderEncryption, util.EncryptionPassphrase)
+		}
+		err = writeBody(w, r, content)
+	}
+	if err != nil {
 		log.Printf("Failed to write response: %v", err)
 	} else {
 		log.Println("Paste request successfully handled")
 	}
 }
 
+// sizeHandler reports how large the clipboard is, so clients can check before fetching it.
+func sizeHandler(w http.ResponseWriter, r *http.Request) {
+	register, err := requestRegister(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var size int
+	if register != "" {
+		size, err = clipboard.RegisterSize(register)
+	} else {
+		size, err = clipboard.Size()
+	}
+	if err != nil {
+		http.Error(w, "Failed to read from clipboard", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(util.HeaderContentSize, strconv.Itoa(size))
+	if _, err := fmt.Fprintln(w, size); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
 func openHandler(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	body, err := readBody(r)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		readBodyFailed(w, err)
+		return
+	}
+
+	if config.MaxOpenURLLength > 0 && len(body) > config.MaxOpenURLLength {
+		log.Printf("Rejected open request: URL is %d bytes, over the %d byte limit", len(body), config.MaxOpenURLLength)
+		http.Error(w, fmt.Sprintf("URL too long: %d bytes (max %d)", len(body), config.MaxOpenURLLength), http.StatusBadRequest)
 		return
 	}
 
 	urlToOpen := string(body)
 	log.Printf("Open request received: '%s'", urlToOpen)
 
+	if status, err := checkOpenURL(urlToOpen); err != nil {
+		log.Printf("Rejected open request: %v", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
 	if err := open.Run(urlToOpen); err != nil {
 		http.Error(w, "Failed to open URL", http.StatusInternalServerError)
 		return
@@ -177,14 +779,31 @@ func openHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Open request successfully handled")
 }
 
+// healthzHandler reports 503 while the in-memory fallback is serving requests, signalling degraded service.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	if clipboard.IsUsingFallback() {
+		http.Error(w, "degraded: using in-memory clipboard fallback", http.StatusServiceUnavailable)
+		return
+	}
+	io.WriteString(w, "ok\n")
+}
+
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := io.WriteString(w, util.GitHead); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+// quitHandler answers first and then stops the server gracefully, so this response and any other
+// request in flight complete
 func quitHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Shutting down server...")
-	w.WriteHeader(http.StatusOK)
-	os.Exit(0)
+	io.WriteString(w, "Shutting down\n")
+	shutdown()
 }
 
-func loadAuthorizedKeys(path string) (map[string]ssh.PublicKey, error) {
-	authorizedKeys := make(map[string]ssh.PublicKey)
+func loadAuthorizedKeys(path string) (map[string]authorizedKey, error) {
+	authorizedKeys := make(map[string]authorizedKey)
 
 	bytes, err := os.ReadFile(path)
 	if err != nil {
@@ -197,7 +816,7 @@ func loadAuthorizedKeys(path string) (map[string]ssh.PublicKey, error) {
 	}
 
 	for len(bytes) > 0 {
-		pubKey, _, _, rest, err := ssh.ParseAuthorizedKey(bytes)
+		pubKey, comment, options, rest, err := ssh.ParseAuthorizedKey(bytes)
 		if err != nil {
 			// Log the error but continue, in case of a malformed line
 			log.Printf("Could not parse authorized key: %v", err)
@@ -206,7 +825,15 @@ func loadAuthorizedKeys(path string) (map[string]ssh.PublicKey, error) {
 		}
 
 		fingerprint := ssh.FingerprintSHA256(pubKey)
-		authorizedKeys[fingerprint] = pubKey
+		expiresAt, err := parseExpiryTime(options)
+		if err != nil {
+			// Refuse the key rather than silently granting it unlimited access
+			log.Printf("Skipping authorized key %s: %v", fingerprint, err)
+			bytes = rest
+			continue
+		}
+
+		authorizedKeys[fingerprint] = authorizedKey{pubKey: pubKey, expiresAt: expiresAt, group: util.KeyGroup(comment)}
 		bytes = rest
 	}
 
@@ -214,10 +841,46 @@ func loadAuthorizedKeys(path string) (map[string]ssh.PublicKey, error) {
 	return authorizedKeys, nil
 }
 
-func generateSelfSignedCert(certPath, keyPath string) error {
-	if _, err := os.Stat(certPath); err == nil {
-		// Certificate already exists
-		return nil
+// parseExpiryTime extracts the expiry-time option from an authorized_keys line, if present.
+// Like OpenSSH, times without a trailing Z are interpreted in the local time zone.
+func parseExpiryTime(options []string) (time.Time, error) {
+	for _, opt := range options {
+		name, value, found := strings.Cut(opt, "=")
+		if !found || !strings.EqualFold(name, util.OptionExpiryTime) {
+			continue
+		}
+
+		value = strings.Trim(value, `"`)
+		loc := time.Local
+		if strings.HasSuffix(value, "Z") {
+			value = strings.TrimSuffix(value, "Z")
+			loc = time.UTC
+		}
+
+		for _, layout := range []string{"20060102150405", "200601021504", "20060102"} {
+			if len(value) == len(layout) {
+				return time.ParseInLocation(layout, value, loc)
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid %s value %q", util.OptionExpiryTime, value)
+	}
+	return time.Time{}, nil
+}
+
+// generateSelfSignedCert creates the server certificate and key unless a certificate that is not
+// close to expiring already exists, in which case it is kept. Renewing reuses the existing key, so
+// the fingerprint clients pin stays the same.
+// The certificate names localhost, this host and the bind address, so clients that check them can.
+func generateSelfSignedCert(certPath, keyPath string, validity time.Duration, bind string) error {
+	if certPEM, err := os.ReadFile(certPath); err == nil {
+		notAfter, err := certExpiry(certPEM)
+		if err != nil {
+			return fmt.Errorf("could not read existing certificate %s: %w", certPath, err)
+		}
+		if time.Until(notAfter) > min(certRenewBefore, validity/2) {
+			return nil
+		}
+		log.Printf("Certificate expires at %s, generating a new one", notAfter.Format(time.RFC3339))
 	}
 
 	// Create the directory if it doesn't exist
@@ -225,42 +888,116 @@ func generateSelfSignedCert(certPath, keyPath string) error {
 		return fmt.Errorf("could not create cert directory: %w", err)
 	}
 
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	// Renewing keeps the key, which is what clients pin, so they keep trusting the server
+	priv, err := readCertKey(keyPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Could not reuse the certificate key, generating a new one that clients must trust again: %v", err)
+		}
+		if priv, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			return err
+		}
+	}
+
+	// RFC 5280 allows serials of up to 20 octets; 128 random bits make collisions practically impossible
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	if err != nil {
 		return err
 	}
 
 	template := x509.Certificate{
-		SerialNumber: big.NewInt(1),
+		SerialNumber: serial,
 		Subject: pkix.Name{
 			Organization: []string{util.ProgramName},
+			CommonName:   "localhost",
 		},
 		NotBefore: time.Now(),
-		NotAfter:  time.Now().Add(time.Hour * 24 * 365 * 10), // 10 years
+		NotAfter:  time.Now().Add(validity),
 
 		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
 	}
+	template.DNSNames, template.IPAddresses = certNames(bind)
 
 	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
 	if err != nil {
 		return err
 	}
 
-	certOut, err := os.Create(certPath)
-	if err != nil {
+	// The key goes first, so a certificate on disk always has its key next to it
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
 		return err
 	}
-	defer certOut.Close()
-	pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+	return os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes}), 0644)
+}
 
-	keyOut, err := os.Create(keyPath)
+// readCertKey reads the RSA key generateSelfSignedCert wrote at keyPath.
+func readCertKey(keyPath string) (*rsa.PrivateKey, error) {
+	keyPEM, err := os.ReadFile(keyPath)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		return nil, fmt.Errorf("no PEM RSA private key found in %s", keyPath)
 	}
-	defer keyOut.Close()
-	pem.Encode(keyOut, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
 
-	return nil
+// certRenewBefore is how long before it expires the certificate is replaced at startup. Short
+// validities renew at half their lifetime instead, so they aren't replaced on every start.
+const certRenewBefore = 30 * 24 * time.Hour
+
+// certExpiry returns when the first certificate in certPEM expires.
+func certExpiry(certPEM []byte) (time.Time, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return time.Time{}, fmt.Errorf("no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
+
+// certNames returns the subject alternative names of the certificate: localhost and its loopback
+// addresses, the machine's hostname and the bind address unless that is all interfaces.
+func certNames(bind string) ([]string, []net.IP) {
+	dnsNames := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" && hostname != "localhost" {
+		dnsNames = append(dnsNames, hostname)
+	}
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	if ip := net.ParseIP(bind); ip != nil && !ip.IsUnspecified() && !ip.IsLoopback() {
+		ips = append(ips, ip)
+	}
+	return dnsNames, ips
+}
+
+// CertFingerprint returns the SHA256 fingerprint of the public key of the server's certificate, which
+// is what clients pin, so they can verify the server out of band before trusting it.
+func CertFingerprint() (string, error) {
+	configDir, err := util.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	certPath := filepath.Join(configDir, "cert.pem")
+
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return "", fmt.Errorf("could not read certificate, the server creates it when first started with TLS: %w", err)
+	}
+	return certFingerprint(certPEM)
+}
+
+// certFingerprint returns the colon-separated SHA256 of the public key of the first certificate in certPEM.
+func certFingerprint(certPEM []byte) (string, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", fmt.Errorf("no PEM certificate found")
+	}
+	return util.PublicKeyFingerprint(block.Bytes)
 }
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRenewedCertKeepsKey(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	// A validity this short is renewed on every start
+	if err := generateSelfSignedCert(certPath, keyPath, time.Nanosecond, ""); err != nil {
+		t.Fatal(err)
+	}
+	firstCert, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := generateSelfSignedCert(certPath, keyPath, time.Nanosecond, ""); err != nil {
+		t.Fatal(err)
+	}
+	renewedCert, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(firstCert) == string(renewedCert) {
+		t.Fatal("certificate was not renewed")
+	}
+	first, err := certFingerprint(firstCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := certFingerprint(renewedCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != renewed {
+		t.Errorf("renewal changed the key fingerprint from %s to %s", first, renewed)
+	}
+}
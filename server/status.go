@@ -0,0 +1,32 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"pb/clipboard"
+	"pb/util"
+	"time"
+)
+
+// statusHandler reports the server version, how long it has been running and which clipboard backend
+// serves requests, so clients can tell when content comes from the in-memory fallback, and how long
+// until the clipboard is cleared if it holds content copied with a TTL.
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	expiresIn := setExpiresIn(w)
+	json.NewEncoder(w).Encode(struct {
+		Version       string    `json:"version"`
+		Backend       string    `json:"backend"`
+		UsingFallback bool      `json:"using_fallback"`
+		Started       time.Time `json:"started"`
+		UptimeSeconds int64     `json:"uptime_seconds"`
+		ExpiresIn     int64     `json:"expires_in_seconds,omitempty"`
+	}{
+		Version:       util.GitHead,
+		Backend:       clipboard.ActiveBackend(),
+		UsingFallback: clipboard.IsUsingFallback(),
+		Started:       startTime,
+		UptimeSeconds: int64(time.Since(startTime).Seconds()),
+		ExpiresIn:     expiresIn,
+	})
+}
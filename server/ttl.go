@@ -0,0 +1,39 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"pb/clipboard"
+	"pb/util"
+	"strconv"
+	"time"
+)
+
+// requestTTL returns how long a copy asks the server to keep its content with X-PB-TTL, or zero to keep it
+// until replaced. Only the clipboard itself expires, not registers or a backend picked by override.
+func requestTTL(r *http.Request, register, backend string) (time.Duration, error) {
+	value := r.Header.Get(util.HeaderTTL)
+	if value == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid TTL %q: must be a positive duration such as 30s", value)
+	}
+	if register != "" || backend != "" {
+		return 0, fmt.Errorf("a TTL only applies to the clipboard, not registers or backend overrides")
+	}
+	return ttl, nil
+}
+
+// setExpiresIn tells the client, in whole seconds rounded up, how long until the clipboard is cleared
+// because a copy made with a TTL expires, so an empty paste later isn't a mystery. It returns the
+// seconds it set, zero when no expiry is pending.
+func setExpiresIn(w http.ResponseWriter) int64 {
+	seconds := int64(math.Ceil(clipboard.ExpiresIn().Seconds()))
+	if seconds > 0 {
+		w.Header().Set(util.HeaderExpiresIn, strconv.FormatInt(seconds, 10))
+	}
+	return seconds
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+)
+
+// versionETag formats a clipboard version as a strong ETag.
+func versionETag(version uint64) string {
+	return strconv.Quote(strconv.FormatUint(version, 10))
+}
+
+// versionMatches reports whether an If-Match header allows writing over the given clipboard version.
+// It accepts a list of ETags, "*", and bare version numbers for clients that don't quote them.
+func versionMatches(ifMatch string, version uint64) bool {
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.Trim(tag, `"`) == strconv.FormatUint(version, 10) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"pb/clipboard"
+	"pb/util"
+	"time"
+)
+
+// watchKeepalive is how often an idle /watch stream gets a comment, so proxies don't time it out
+const watchKeepalive = 30 * time.Second
+
+// watchHandler streams the clipboard to the client as server-sent events, one each time it changes,
+// until the client disconnects. All watchers share the clipboard package's single change poller.
+// Clients asking for util.WatchFormatJSON get the change as a util.WatchFrame with its metadata.
+func watchHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	updates, unsubscribe, err := clipboard.Subscribe(requestFingerprint(r))
+	if err != nil {
+		http.Error(w, "Failed to watch clipboard", http.StatusInternalServerError)
+		return
+	}
+	defer unsubscribe()
+	structured := r.Header.Get(util.HeaderWatchFormat) == util.WatchFormatJSON
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	log.Printf("Clipboard watcher %s connected", requestFingerprint(r))
+
+	keepalive := time.NewTicker(watchKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Printf("Clipboard watcher %s disconnected", requestFingerprint(r))
+			return
+		case <-stopping:
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case content, ok := <-updates:
+			if !ok {
+				return
+			}
+			event, data, err := watchEvent(content, structured)
+			if err != nil {
+				log.Printf("Skipped clipboard change for watcher: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// watchEvent prepares changed content for a watcher the way a paste would be: through the paste filter,
+// then sealed with the passphrase when one is set. It returns the event type and its data: the base64
+// content, whose event type announces whether it is sealed, or a JSON util.WatchFrame when structured.
+func watchEvent(content []byte, structured bool) (string, string, error) {
+	var err error
+	if config.PasteFilter != "" {
+		if content, err = runFilter(config.PasteFilter, content); err != nil {
+			return "", "", err
+		}
+	}
+	frame := util.WatchFrame{Timestamp: time.Now(), Size: len(content), Backend: clipboard.ActiveBackend()}
+	event := util.EventClipboard
+	if config.Passphrase != "" {
+		if content, err = util.EncryptWithPassphrase(config.Passphrase, content); err != nil {
+			return "", "", err
+		}
+		frame.Encryption = util.EncryptionPassphrase
+		event = util.EventClipboardPassphrase
+	}
+	frame.ContentBase64 = base64.StdEncoding.EncodeToString(content)
+	if !structured {
+		return event, frame.ContentBase64, nil
+	}
+
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return "", "", err
+	}
+	return util.EventChange, string(data), nil
+}
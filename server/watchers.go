@@ -0,0 +1,34 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"pb/clipboard"
+	"time"
+)
+
+// watcherStatus is one entry of the /watchers response.
+type watcherStatus struct {
+	Fingerprint string    `json:"fingerprint"`
+	Since       time.Time `json:"since"`
+}
+
+// watchersHandler reports who is subscribed to clipboard changes and whether the poller is running for them.
+func watchersHandler(w http.ResponseWriter, r *http.Request) {
+	infos, polling := clipboard.Watchers()
+	watchers := make([]watcherStatus, len(infos))
+	for i, info := range infos {
+		watchers[i] = watcherStatus{Fingerprint: info.Owner, Since: info.Since}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Count    int             `json:"count"`
+		Polling  bool            `json:"polling"`
+		Watchers []watcherStatus `json:"watchers"`
+	}{
+		Count:    len(watchers),
+		Polling:  polling,
+		Watchers: watchers,
+	})
+}
@@ -0,0 +1,33 @@
+package util
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// CertFingerprint returns the SHA256 of a DER certificate as colon-separated hex pairs, the way
+// openssl prints it, so what the client pins can be compared with what the server reports
+func CertFingerprint(der []byte) string {
+	return colonHex(sha256.Sum256(der))
+}
+
+// PublicKeyFingerprint returns the SHA256 of the public key (the SubjectPublicKeyInfo) of a DER
+// certificate, written like CertFingerprint. Unlike the certificate's, it survives renewals that keep the key.
+func PublicKeyFingerprint(der []byte) (string, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return "", err
+	}
+	return colonHex(sha256.Sum256(cert.RawSubjectPublicKeyInfo)), nil
+}
+
+// colonHex writes sum as colon-separated uppercase hex pairs
+func colonHex(sum [sha256.Size]byte) string {
+	hexPairs := make([]string, len(sum))
+	for i, b := range sum {
+		hexPairs[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hexPairs, ":")
+}
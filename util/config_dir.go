@@ -0,0 +1,42 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// configDirOverride is set from --config-dir or PB_CONFIG_DIR and takes precedence over XDG_CONFIG_HOME.
+var configDirOverride string
+
+// SetConfigDir overrides the directory returned by ConfigDir. An empty dir restores the default.
+func SetConfigDir(dir string) {
+	configDirOverride = dir
+}
+
+// ConfigDir returns the directory holding keys, certificates and authorized_keys.
+// It is the override when set, otherwise $XDG_CONFIG_HOME/pb, otherwise ~/.config/pb.
+func ConfigDir() (string, error) {
+	if configDirOverride != "" {
+		return configDirOverride, nil
+	}
+
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, ProgramName), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not get user home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", ProgramName), nil
+}
+
+// ConfigPath returns the path of a file inside ConfigDir.
+func ConfigPath(name string) (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
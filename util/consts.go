@@ -8,11 +8,54 @@ const DefaultPort = 2850
 const EnvVarServer = "PB_CLIPBOARD_SERVER"
 const EnvVarPort = "PB_CLIPBOARD_PORT"
 const EnvVarKey = "PB_CLIPBOARD_KEY"
+const EnvVarConfigDir = "PB_CONFIG_DIR"
+const EnvVarPassphrase = "PB_PASSPHRASE"
+
+// OptionExpiryTime is the OpenSSH authorized_keys option recording when a key stops being accepted
+const OptionExpiryTime = "expiry-time"
+const ExpiryTimeLayout = "20060102150405Z"
 
 const HeaderFingerprint = "X-PB-Key-Fingerprint"
 const HeaderSignature = "X-PB-Signature"
+const HeaderSignatureHash = "X-PB-Signature-Hash" // hash the signed digest was computed with, sha256 when absent
+const HeaderCapabilities = "X-PB-Capabilities"
+const HeaderBackend = "X-PB-Backend"
+const HeaderDegraded = "X-PB-Degraded"
+const HeaderContentSize = "X-PB-Content-Size" // uncompressed size of the clipboard content
+const HeaderRegister = "X-PB-Register"
+const HeaderNamespace = "X-PB-Namespace"
+const HeaderEncryption = "X-PB-Encryption"    // how the body is encrypted on top of TLS, if at all
+const HeaderOpaque = "X-PB-Opaque"            // "true" when the client encrypted the content end to end, so the server must not alter it
+const HeaderTTL = "X-PB-TTL"                  // how long the server keeps copied content before clearing it, as a Go duration
+const HeaderExpiresIn = "X-PB-Expires-In"     // seconds left until the server clears content copied with a TTL
+const HeaderWatchFormat = "X-PB-Watch-Format" // WatchFormatJSON asks /watch for structured frames
+
+// RegisterShared selects the clipboard shared by all keys when the server gives each key its own
+const RegisterShared = "shared"
+
+// Server-sent event types on the /watch stream; the clipboard events carry the base64 content as their data
+const EventClipboard = "clipboard"                      // plain content
+const EventClipboardPassphrase = "clipboard-passphrase" // content sealed with EncryptWithPassphrase
+const EventChange = "change"                            // a JSON WatchFrame, sent instead when the client asks for WatchFormatJSON
+
+const CapabilityGzip = "gzip"
+const CapabilityTrailerSignature = "trailer-signature" // signature may arrive in a trailer after a streamed body
+
+// GzipThreshold is the smallest body either side bothers to gzip; below it the gzip header
+// and the CPU cost outweigh what compression saves
+const GzipThreshold = 1024
 
 const RequestCopy = "/copy"
 const RequestPaste = "/paste"
 const RequestOpen = "/open"
 const RequestQuit = "/quit"
+const RequestVersion = "/version"
+const RequestHealthz = "/healthz"
+const RequestSize = "/size"
+const RequestRegisters = "/registers"
+const RequestWatchers = "/watchers"
+const RequestWatch = "/watch"
+const RequestHistory = "/history"
+const RequestBackup = "/backup"
+const RequestClear = "/clear"
+const RequestStatus = "/status"
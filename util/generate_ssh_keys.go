@@ -3,7 +3,6 @@ package util
 import (
 	"crypto/ed25519"
 	"crypto/rand"
-	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"golang.org/x/crypto/ssh"
@@ -22,16 +21,12 @@ func GenerateSSHKeys(keyDir string) error {
 		return fmt.Errorf("cannot generate ed25519 key: %w", err)
 	}
 
-	// Encode private key to PEM format using the standard library
-	pkcs8Key, err := x509.MarshalPKCS8PrivateKey(privKey)
+	// Encode private key in the OpenSSH format so ssh.ParsePrivateKey can read it back
+	privBlock, err := ssh.MarshalPrivateKey(privKey, "")
 	if err != nil {
 		return fmt.Errorf("could not marshal private key: %w", err)
 	}
-	privBlock := pem.Block{
-		Type:  "OPENSSH PRIVATE KEY",
-		Bytes: pkcs8Key,
-	}
-	privatePEM := pem.EncodeToMemory(&privBlock)
+	privatePEM := pem.EncodeToMemory(privBlock)
 	err = os.WriteFile(filepath.Join(keyDir, "id_ed25519"), privatePEM, 0600)
 	if err != nil {
 		return fmt.Errorf("unable to save private key: %w", err)
@@ -0,0 +1,16 @@
+package util
+
+import "strings"
+
+// GroupTagPrefix marks the group of an authorized key within its comment, e.g. "laptop group:team-a".
+const GroupTagPrefix = "group:"
+
+// KeyGroup returns the group named by a group:NAME tag in an authorized_keys comment, or "" if there is none.
+func KeyGroup(comment string) string {
+	for _, field := range strings.Fields(comment) {
+		if name, ok := strings.CutPrefix(field, GroupTagPrefix); ok && name != "" {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// EncryptionPassphrase is the HeaderEncryption value for bodies sealed with EncryptWithPassphrase.
+const EncryptionPassphrase = "passphrase"
+
+const (
+	passphraseSaltSize = 16
+	passphraseKeySize  = 32 // AES-256
+)
+
+// ErrWrongPassphrase is returned when content can't be decrypted, usually because the passphrases differ.
+var ErrWrongPassphrase = errors.New("could not decrypt content, do the client and server passphrases match?")
+
+// EncryptWithPassphrase seals plaintext with AES-GCM under a key derived from passphrase with scrypt.
+// The output is salt, nonce and ciphertext, so each message uses a fresh key and nonce.
+func EncryptWithPassphrase(passphrase string, plaintext []byte) ([]byte, error) {
+	salt := make([]byte, passphraseSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("could not generate salt: %w", err)
+	}
+
+	gcm, err := passphraseCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("could not generate nonce: %w", err)
+	}
+
+	out := append(salt, nonce...)
+	return gcm.Seal(out, nonce, plaintext, nil), nil
+}
+
+// DecryptWithPassphrase opens content sealed by EncryptWithPassphrase.
+func DecryptWithPassphrase(passphrase string, data []byte) ([]byte, error) {
+	if len(data) < passphraseSaltSize {
+		return nil, ErrWrongPassphrase
+	}
+	salt, rest := data[:passphraseSaltSize], data[passphraseSaltSize:]
+
+	gcm, err := passphraseCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < gcm.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+
+	nonce, ciphertext := rest[:gcm.NonceSize()], rest[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+// passphraseCipher derives the AES-GCM cipher for passphrase and salt.
+func passphraseCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, passphraseKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("could not derive key from passphrase: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
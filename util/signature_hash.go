@@ -0,0 +1,63 @@
+package util
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"slices"
+	"sort"
+)
+
+// Hash algorithms a request body can be digested with before signing.
+const (
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+)
+
+// DefaultSignatureHash is used when a request doesn't name its hash, as older clients don't.
+const DefaultSignatureHash = HashSHA256
+
+var signatureHashes = map[string]func() hash.Hash{
+	HashSHA256: sha256.New,
+	HashSHA512: sha512.New,
+}
+
+// SignatureHashes returns the names of every supported signature hash, sorted.
+func SignatureHashes() []string {
+	names := make([]string, 0, len(signatureHashes))
+	for name := range signatureHashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSignatureHash returns a new hash.Hash for the named algorithm.
+func NewSignatureHash(name string) (hash.Hash, error) {
+	newHash, ok := signatureHashes[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signature hash %q (expected one of %v)", name, SignatureHashes())
+	}
+	return newHash(), nil
+}
+
+// SignatureDigest hashes data with the named algorithm.
+func SignatureDigest(name string, data []byte) ([]byte, error) {
+	h, err := NewSignatureHash(name)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// ValidSignatureHashes checks that every name is a supported signature hash.
+func ValidSignatureHashes(names []string) error {
+	for _, name := range names {
+		if !slices.Contains(SignatureHashes(), name) {
+			return fmt.Errorf("unsupported signature hash %q (expected one of %v)", name, SignatureHashes())
+		}
+	}
+	return nil
+}
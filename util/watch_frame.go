@@ -0,0 +1,15 @@
+package util
+
+import "time"
+
+// WatchFormatJSON asks /watch, in the HeaderWatchFormat header, for EventChange events carrying a WatchFrame
+const WatchFormatJSON = "json"
+
+// WatchFrame describes one clipboard change on a structured /watch stream
+type WatchFrame struct {
+	Timestamp     time.Time `json:"timestamp"`
+	Size          int       `json:"size"` // length of the content before any encryption
+	ContentBase64 string    `json:"content_base64"`
+	Backend       string    `json:"backend"`              // clipboard backend the change was read from
+	Encryption    string    `json:"encryption,omitempty"` // how the content is sealed, as in HeaderEncryption
+}